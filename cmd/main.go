@@ -2,27 +2,514 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 
 	fileAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/file"
+	prometheusAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/prometheus"
+	s3Adapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/s3"
+	sourceAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/source"
+	traceAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/trace"
 	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
 )
 
+// spaceCheckInterval is how often -space-wait checks the free space.
+const spaceCheckInterval = 10 * time.Second
+
 func main() {
+	ctx := signalContext()
+	if len(os.Args) > 1 && os.Args[1] == "lookup" {
+		err := lookup(os.Args[2:])
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		err := diff(ctx, os.Args[2:])
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
 	n := flag.Int("N", 2, "an int")
-	//n := 2
-	workers := 1
-	storage := fileAdapter.NewStorage()
-	service := mapreduce.NewService(*n, workers, storage)
-	outputFileName, err := service.Do(context.Background(), "input.txt")
+	workers := flag.Int("workers", runtime.GOMAXPROCS(0), "goroutines writing partitions in parallel")
+	input := flag.String("input", "input.txt", "input file, - reads standard input, http(s):// URLs are downloaded")
+	top := flag.Int("top", 0, "write only the K most frequent words ordered by count, 0 writes the full table")
+	fullOutput := flag.String("full-output", "", "with -top, also write the full alphabetical table to this file in the -format of the output")
+	sortFlag := flag.String("sort", "word", "output order: word, count or count-desc")
+	formatFlag := flag.String("format", "tsv", "output format: tsv, csv, ndjson, json or binary")
+	header := flag.Bool("header", false, "write a header row (tsv, csv) or magic prefix (binary)")
+	output := flag.String("output", "", "output file name, default is output.<format extension>")
+	index := flag.Bool("index", false, "write a sparse index <output>.idx for the lookup subcommand, tsv format and word order only")
+	indexInterval := flag.Int("index-interval", mapreduce.DefaultIndexInterval, "rows per sparse index entry")
+	update := flag.String("update", "", "previous alphabetical tsv result to add the input to, the new cumulative table is written to -output")
+	subtract := flag.Bool("subtract", false, "with -update, remove the input from the previous result instead of adding it")
+	include := flag.String("include", "", "with an archive -input, comma separated patterns of members to read")
+	exclude := flag.String("exclude", "", "with an archive -input, comma separated patterns of members to skip")
+	perMemberDir := flag.String("per-member-dir", "", "with an archive -input, write a result per member into this directory instead of one result")
+	partitions := flag.Int("partitions", 0, "split the output into this many part-NNNNN.tsv files by word hash")
+	partitionBounds := flag.String("partition-bounds", "", "comma separated sorted words to split the output into part-NNNNN.tsv files by word range")
+	metricsAddr := flag.String("metrics-addr", "", "serve Prometheus metrics of the job on this address, e.g. :9090, at /metrics")
+	showProgress := flag.Bool("progress", false, "report progress with an ETA on stderr: a live line on a terminal, a log line every 10s otherwise")
+	saturate := flag.Bool("saturate", false, "stick counts that overflow int64 at the limit instead of failing")
+	useMmap := flag.Bool("mmap", false, "memory-map local input and intermediate files instead of buffered reading")
+	tempDir := flag.String("temp-dir", "", "directory or s3://bucket/prefix for intermediate files, default is the current directory")
+	s3Endpoint := flag.String("s3-endpoint", envOr("AWS_ENDPOINT_URL", "https://s3.amazonaws.com"), "endpoint of the S3-compatible store for s3:// names")
+	s3Region := flag.String("s3-region", envOr("AWS_REGION", "us-east-1"), "region of the S3-compatible store")
+	logLevel := flag.String("log-level", "info", "log level: debug, info, warn or error; debug logs every spill and merge")
+	logFormat := flag.String("log-format", "text", "log format on stderr: text or json")
+	showStats := flag.Bool("stats", false, "print statistics of the job on stderr when it is done")
+	statsFile := flag.String("stats-file", "", "write statistics of the job as JSON to this file when it is done")
+	manifestFile := flag.String("manifest", "", "a job that fails or is interrupted after mapping keeps its sorted intermediate files and lists them in this file, the next run of the same -input resumes from them")
+	maxTempBytes := flag.Int64("max-temp-bytes", 0, "cap the bytes of intermediate files on local disk, a job that would exceed it fails before the spill or merge, 0 is no cap")
+	spaceWait := flag.Duration("space-wait", 0, "when a spill or merge doesn't fit on the temp disk, wait this long for space before failing, 0 fails at once")
+	traceFile := flag.String("trace-file", "", "write spans of the job phases, spills and merges as JSON lines to this file, - is standard output")
+	flag.Parse()
+
+	var logOut io.Writer = os.Stderr
+	var printer *progressPrinter
+	if *showProgress {
+		printer = newProgressPrinter(os.Stderr)
+		logOut = printer
+		defer printer.finish()
+	}
+	logger, err := newLogger(logOut, *logLevel, *logFormat)
+	if err != nil {
+		fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	order, err := mapreduce.ParseSortOrder(*sortFlag)
+	if err != nil {
+		fatal(err)
+	}
+	format, err := mapreduce.ParseOutputFormat(*formatFlag)
+	if err != nil {
+		fatal(err)
+	}
+	if *output == "" {
+		*output = "output." + format.Extension()
+	}
+	if *workers < 1 {
+		fatal(errors.New("-workers should be at least 1"))
+	}
+	fileOpts := []fileAdapter.Option{fileAdapter.WithLogger(logger)}
+	if *useMmap {
+		fileOpts = append(fileOpts, fileAdapter.WithMmap())
+	}
+	var storage mapreduce.Storage = fileAdapter.NewStorage(fileOpts...)
+	// results, also the partitions of the service, are written through a storage of their own, -max-temp-bytes only caps intermediate files
+	resultStorage := storage
+	if *maxTempBytes > 0 {
+		storage = fileAdapter.NewStorage(append(fileOpts, fileAdapter.WithMaxBytes(*maxTempBytes))...)
+	}
+	if s3Adapter.IsURL(*input) || s3Adapter.IsURL(*output) || s3Adapter.IsURL(*update) || s3Adapter.IsURL(*tempDir) {
+		// credentials come from the usual AWS environment variables
+		s3Storage, err := s3Adapter.NewStorage(s3Adapter.Config{
+			Endpoint:  *s3Endpoint,
+			Region:    *s3Region,
+			AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			Context:   ctx,
+		})
+		if err != nil {
+			fatal(err)
+		}
+		storage = s3Adapter.NewRouter(s3Storage, storage)
+		resultStorage = s3Adapter.NewRouter(s3Storage, resultStorage)
+	}
+	opts := []mapreduce.Option{mapreduce.WithMemoryFastPath(), mapreduce.WithTempDir(*tempDir), mapreduce.WithLogger(logger),
+		mapreduce.WithResultStorage(resultStorage)}
+	if *saturate {
+		opts = append(opts, mapreduce.WithSaturatingCounts())
+	}
+	if *manifestFile != "" {
+		opts = append(opts, mapreduce.WithManifest(*manifestFile))
+	}
+	if *spaceWait > 0 {
+		opts = append(opts, mapreduce.WithSpaceRetry(min(*spaceWait, spaceCheckInterval), *spaceWait))
+	}
+	if *metricsAddr != "" {
+		metrics := mapreduce.NewMetrics()
+		err = serveMetrics(*metricsAddr, metrics)
+		if err != nil {
+			fatal(err)
+		}
+		opts = append(opts, mapreduce.WithMetrics(metrics))
+	}
+	if *traceFile != "" {
+		tracer, closeTrace, err := newTracer(*traceFile)
+		if err != nil {
+			fatal(err)
+		}
+		defer closeTrace()
+		opts = append(opts, mapreduce.WithTracer(tracer))
+	}
+	if printer != nil {
+		opts = append(opts, mapreduce.WithProgress(printer.interval(), printer.report))
+	}
+	if *input == "-" {
+		opts = append(opts, mapreduce.WithSource(sourceAdapter.NewReaderSource(os.Stdin)))
+	} else if sourceAdapter.IsHTTPURL(*input) {
+		opts = append(opts, mapreduce.WithSource(sourceAdapter.NewHTTPSource(nil, 0, 0, sourceAdapter.WithContext(ctx))))
+	}
+	service := mapreduce.NewService(*n, *workers, storage, opts...)
+
+	if *partitions > 0 || *partitionBounds != "" {
+		if *showStats || *statsFile != "" {
+			fatal(errors.New("-stats and -stats-file can't be combined with -partitions or -partition-bounds"))
+		}
+		err = writePartitions(ctx, service, *input, *partitions, *partitionBounds)
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if *index && (format != mapreduce.FormatTSV || order != mapreduce.SortByWord) {
+		fatal(errors.New("-index needs -format tsv and -sort word"))
+	}
+	if *index && *top > 0 {
+		fatal(errors.New("-index can't be combined with -top, the top words aren't in word order"))
+	}
+	if *top > 0 && order != mapreduce.SortByWord {
+		fatal(errors.New("-top can't be combined with -sort, the top words are always ordered by count"))
+	}
+	if *update != "" && (*top > 0 || order != mapreduce.SortByWord) {
+		fatal(errors.New("-update can't be combined with -top or -sort"))
+	}
+	if (*showStats || *statsFile != "") && (*top > 0 || *update != "" || *perMemberDir != "") {
+		fatal(errors.New("-stats and -stats-file can't be combined with -top, -update or -per-member-dir"))
+	}
+	// reportStats reports the stats of the job as asked by -stats and -stats-file
+	reportStats := func(stats mapreduce.Stats) error {
+		if *showStats {
+			err := writeStatsTable(logOut, stats)
+			if err != nil {
+				return err
+			}
+		}
+		if *statsFile != "" {
+			return writeStatsFile(*statsFile, stats)
+		}
+		return nil
+	}
+
+	newWriter := func(out mapreduce.OutputFile) (mapreduce.ResultWriter, error) {
+		if !*index {
+			return mapreduce.NewResultWriter(out, format, *header)
+		}
+		indexOut, err := resultStorage.CreateOutputFile(*output + ".idx")
+		if err != nil {
+			return nil, err
+		}
+		return mapreduce.NewIndexedResultWriter(out, indexOut, *header, *indexInterval)
+	}
+
+	if *update != "" {
+		// the previous result is read while the new one is written, it may be the same file.
+		// An object only replaces the previous one when it is closed, so s3 writes in place.
+		resultName := *output + ".tmp"
+		if s3Adapter.IsURL(*output) {
+			resultName = *output
+		}
+		err = writeResult(resultStorage, resultName, newWriter, func(w mapreduce.ResultWriter) error {
+			return service.Update(ctx, *update, *input, *subtract, w)
+		})
+		if err != nil {
+			fatal(err)
+		}
+		if resultName != *output {
+			err = os.Rename(resultName, *output)
+			if err != nil {
+				fatal(err)
+			}
+		}
+		return
+	}
+
+	if fileAdapter.IsArchive(*input) {
+		if *top > 0 || *update != "" || *index {
+			fatal(errors.New("an archive -input can't be combined with -top, -update or -index"))
+		}
+		archive, err := fileAdapter.OpenArchive(*input, splitList(*include), splitList(*exclude))
+		if err != nil {
+			fatal(err)
+		}
+		if *perMemberDir != "" {
+			err = writePerMember(ctx, service, resultStorage, archive, *perMemberDir, format, func(out mapreduce.OutputFile) (mapreduce.ResultWriter, error) {
+				return mapreduce.NewResultWriter(out, format, *header)
+			}, order)
+		} else {
+			var stats mapreduce.Stats
+			err = writeResult(resultStorage, *output, newWriter, func(w mapreduce.ResultWriter) (err error) {
+				stats, err = service.DoInputsTo(ctx, archive.Each, order, w)
+				return err
+			})
+			if err == nil {
+				err = reportStats(stats)
+			}
+		}
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	var stats mapreduce.Stats
+	err = writeResult(resultStorage, *output, newWriter, func(w mapreduce.ResultWriter) (err error) {
+		if *top > 0 {
+			if *fullOutput == "" {
+				return writeTopK(ctx, service, w, *input, *top, nil)
+			}
+			// the full table gets the -format and -header of the output
+			return writeResult(resultStorage, *fullOutput, func(out mapreduce.OutputFile) (mapreduce.ResultWriter, error) {
+				return mapreduce.NewResultWriter(out, format, *header)
+			}, func(full mapreduce.ResultWriter) error {
+				return writeTopK(ctx, service, w, *input, *top, full)
+			})
+		}
+		stats, err = service.DoTo(ctx, *input, order, w)
+		return err
+	})
+	if err != nil {
+		fatal(err)
+	}
+	if *top == 0 {
+		err = reportStats(stats)
+		if err != nil {
+			fatal(err)
+		}
+	}
+}
+
+// serveMetrics listens on addr right away, so a busy port fails the job
+// before it starts, and serves /metrics in the background.
+func serveMetrics(addr string, metrics *mapreduce.Metrics) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("metrics listener failed, error=%w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", prometheusAdapter.NewHandler(metrics))
+	go func() {
+		err := http.Serve(listener, mux)
+		slog.Error("metrics server stopped", "error", err)
+	}()
+
+	return nil
+}
+
+// newTracer writes spans to name, closeTrace reports a failed write or close.
+func newTracer(name string) (_ *traceAdapter.JSONTracer, closeTrace func(), err error) {
+	out := os.Stdout
+	if name != "-" {
+		out, err = os.Create(name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("create trace file failed, error=%w", err)
+		}
+	}
+	tracer := traceAdapter.NewJSONTracer(out)
+
+	return tracer, func() {
+		err := tracer.Err()
+		if out != os.Stdout {
+			err = errors.Join(err, out.Close())
+		}
+		if err != nil {
+			slog.Error("trace incomplete", "error", err)
+		}
+	}, nil
+}
+
+func writeResult(storage mapreduce.Storage, name string, newWriter func(out mapreduce.OutputFile) (mapreduce.ResultWriter, error), write func(w mapreduce.ResultWriter) error) (err error) {
+	out, err := storage.CreateOutputFile(name)
+	if err != nil {
+		return err
+	}
+	w, err := newWriter(out)
+	if err != nil {
+		return errors.Join(err, out.Close())
+	}
+	defer func() {
+		err = errors.Join(err, w.Close())
+	}()
+
+	return write(w)
+}
+
+// writePerMember counts every archive member on its own, results keep the
+// member paths under dir.
+func writePerMember(ctx context.Context, service *mapreduce.Service, storage mapreduce.Storage, archive *fileAdapter.Archive, dir string, format mapreduce.OutputFormat, newWriter func(out mapreduce.OutputFile) (mapreduce.ResultWriter, error), order mapreduce.SortOrder) error {
+	return archive.Each(func(name string, input mapreduce.InputFile) error {
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("archive member %q points outside of the output directory", name)
+		}
+		resultName := filepath.Join(dir, filepath.FromSlash(name)) + "." + format.Extension()
+		err := os.MkdirAll(filepath.Dir(resultName), 0o755)
+		if err != nil {
+			return err
+		}
+
+		member := func(fn func(name string, input mapreduce.InputFile) error) error {
+			return fn(name, input)
+		}
+		return writeResult(storage, resultName, newWriter, func(w mapreduce.ResultWriter) error {
+			_, err := service.DoInputsTo(ctx, member, order, w)
+			return err
+		})
+	})
+}
+
+func envOr(name, value string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return value
+}
+
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+func writePartitions(ctx context.Context, service *mapreduce.Service, input string, partitions int, bounds string) error {
+	var partitioner mapreduce.Partitioner
+	var err error
+	if bounds != "" {
+		partitioner, err = mapreduce.NewRangePartitioner(strings.Split(bounds, ","))
+	} else {
+		partitioner, err = mapreduce.NewHashPartitioner(partitions)
+	}
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	err = os.Rename(outputFileName, "output.tsv")
+	_, err = service.DoPartitioned(ctx, input, partitioner)
+	return err
+}
+
+func writeTopK(ctx context.Context, service *mapreduce.Service, w mapreduce.ResultWriter, input string, k int, full mapreduce.ResultWriter) error {
+	top, err := service.TopK(ctx, input, k, full)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+
+	for _, wc := range top {
+		err = w.Write(wc.Word, wc.Count)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func lookup(args []string) error {
+	flags := flag.NewFlagSet("lookup", flag.ExitOnError)
+	result := flags.String("output", "output.tsv", "result file written with -index")
+	prefix := flags.String("prefix", "", "print all words with this prefix")
+	from := flags.String("from", "", "print words starting from this one, inclusive")
+	to := flags.String("to", "", "with -from, print words up to this one, exclusive")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s lookup [flags] [word]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	l, err := mapreduce.NewLookup(fileAdapter.NewStorage(), *result, *result+".idx")
+	if err != nil {
+		return err
+	}
+	printRow := func(word string, count int64) error {
+		_, err := fmt.Printf("%s\t%d\n", word, count)
+		return err
+	}
+
+	switch {
+	case flags.NArg() > 0:
+		for _, word := range flags.Args() {
+			count, found, err := l.Get(word)
+			if err != nil {
+				return err
+			}
+			if found {
+				err = printRow(word, count)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case *prefix != "":
+		return l.Prefix(*prefix, printRow)
+	case *from != "" || *to != "":
+		return l.Range(*from, *to, printRow)
+	default:
+		flags.Usage()
+		return fmt.Errorf("lookup needs a word, -prefix or -from/-to")
+	}
+}
+
+func diff(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	top := flags.Int("top", 0, "print only the N largest changes by absolute delta")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s diff [flags] old.tsv new.tsv\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("diff needs two alphabetical tsv results")
+	}
+
+	printDiff := func(d mapreduce.WordDiff) error {
+		_, err := fmt.Printf("%s\t%s\t%d\t%d\t%+d\t%+.4f\n", d.Kind, d.Word, d.Old, d.New, d.Delta, d.Relative)
+		return err
+	}
+	emit := printDiff
+	var topN *mapreduce.DiffTopN
+	if *top > 0 {
+		topN = mapreduce.NewDiffTopN(*top)
+		emit = topN.Add
+	}
+
+	service := mapreduce.NewService(0, 1, fileAdapter.NewStorage())
+	stats, err := service.Diff(ctx, flags.Arg(0), flags.Arg(1), emit)
+	if err != nil {
+		return err
+	}
+	if topN != nil {
+		for _, d := range topN.Result() {
+			err = printDiff(d)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = fmt.Fprintf(os.Stderr, "added %d, removed %d, changed %d, unchanged %d, total %d -> %d\n",
+		stats.Added, stats.Removed, stats.Changed, stats.Unchanged, stats.OldTotal, stats.NewTotal)
+	return err
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+const (
+	ttyProgressInterval = 200 * time.Millisecond
+	logProgressInterval = 10 * time.Second
+)
+
+// progressPrinter renders progress on stderr: a line redrawn in place on a
+// terminal, a log line every logProgressInterval otherwise. It is also the
+// log output, so log messages don't get glued to an unfinished progress line.
+type progressPrinter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	tty     bool
+	pending bool // a progress line is drawn without a line break
+}
+
+func newProgressPrinter(out *os.File) *progressPrinter {
+	info, err := out.Stat()
+	tty := err == nil && info.Mode()&os.ModeCharDevice != 0
+	return &progressPrinter{out: out, tty: tty}
+}
+
+func (p *progressPrinter) interval() time.Duration {
+	if p.tty {
+		return ttyProgressInterval
+	}
+	return logProgressInterval
+}
+
+func (p *progressPrinter) report(progress mapreduce.Progress) {
+	if !p.tty {
+		slog.Info("progress", progressAttrs(progress)...)
+		return
+	}
+	line := formatProgress(progress)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// \r and erase the line, then draw over it
+	fmt.Fprintf(p.out, "\r\033[K%s", line)
+	p.pending = true
+}
+
+// Write writes log output on a line of its own.
+func (p *progressPrinter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.endLine()
+	return p.out.Write(b)
+}
+
+// finish ends the progress line once the job is done.
+func (p *progressPrinter) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.endLine()
+}
+
+func (p *progressPrinter) endLine() {
+	if p.pending {
+		fmt.Fprintln(p.out)
+		p.pending = false
+	}
+}
+
+func formatProgress(p mapreduce.Progress) string {
+	var b strings.Builder
+	b.WriteString(p.Phase.String())
+	switch p.Phase {
+	case mapreduce.PhaseMap:
+		b.WriteString(" " + formatBytes(float64(p.BytesRead)))
+		if p.InputSize > 0 {
+			fmt.Fprintf(&b, " of %s (%.1f%%)", formatBytes(float64(p.InputSize)), 100*float64(p.BytesRead)/float64(p.InputSize))
+		}
+		fmt.Fprintf(&b, ", %d lines, %d spills, %s/s", p.Lines, p.Spills, formatBytes(p.Throughput()))
+	case mapreduce.PhaseReduce:
+		fmt.Fprintf(&b, " round %d of %d, %d spills of %s", p.MergeRounds, p.MergeRoundsTotal, p.Spills, formatBytes(float64(p.BytesRead)))
+	}
+	fmt.Fprintf(&b, ", elapsed %s", p.Elapsed.Round(time.Second))
+	if eta, ok := p.ETA(); ok {
+		fmt.Fprintf(&b, ", ETA %s", eta.Round(time.Second))
+	}
+
+	return b.String()
+}
+
+// progressAttrs are the fields of a progress log record.
+func progressAttrs(p mapreduce.Progress) []any {
+	attrs := []any{
+		"phase", p.Phase.String(),
+		"bytes_read", p.BytesRead,
+		"input_size", p.InputSize,
+		"lines", p.Lines,
+		"spills", p.Spills,
+		"merge_rounds", p.MergeRounds,
+		"merge_rounds_total", p.MergeRoundsTotal,
+		"elapsed", p.Elapsed.Round(time.Second),
+	}
+	if eta, ok := p.ETA(); ok {
+		attrs = append(attrs, "eta", eta.Round(time.Second))
+	}
+
+	return attrs
+}
+
+func formatBytes(n float64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	exp := 0
+	for n >= unit*unit && exp < 4 {
+		n /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", n/unit, "KMGTP"[exp])
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// signalContext is cancelled by the first SIGINT or SIGTERM, so the job stops
+// and removes its intermediate files. A second signal kills the process right
+// away.
+func signalContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		// from now on the default handling of the signals terminates the process
+		stop()
+		slog.Warn("interrupted, stopping the job and cleaning up, interrupt again to exit immediately")
+	}()
+
+	return ctx
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// writeStatsTable prints the stats of a job as two aligned tables, the totals
+// and the phases.
+func writeStatsTable(out io.Writer, stats mapreduce.Stats) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "tokens\t%d\n", stats.Tokens)
+	fmt.Fprintf(w, "unique keys\t%d\n", stats.UniqueKeys)
+	fmt.Fprintf(w, "singletons\t%d\n", stats.Singletons)
+	fmt.Fprintf(w, "spill runs\t%d\n", stats.SpillRuns)
+	fmt.Fprintf(w, "merge passes\t%d\n", stats.MergePasses)
+	fmt.Fprintf(w, "peak keys in memory\t%d\n", stats.PeakKeys)
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nphase\tread\twritten\twall\tcpu")
+	for _, phase := range []struct {
+		name  string
+		stats mapreduce.PhaseStats
+	}{{"map", stats.Map}, {"reduce", stats.Reduce}} {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", phase.name,
+			formatBytes(float64(phase.stats.BytesRead)), formatBytes(float64(phase.stats.BytesWritten)),
+			phase.stats.Wall.Round(time.Millisecond), phase.stats.CPU.Round(time.Millisecond))
+	}
+
+	return w.Flush()
+}
+
+// writeStatsFile writes the stats of a job as JSON.
+func writeStatsFile(name string, stats mapreduce.Stats) error {
+	b, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal stats failed, error=%w", err)
+	}
+	err = os.WriteFile(name, append(b, '\n'), 0o644)
+	if err != nil {
+		return fmt.Errorf("write stats file failed, error=%w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package fault
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	sourceAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/source"
+	mapReduceDomain "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// ErrInjected is matched by every error the Storage injects.
+var ErrInjected = errors.New("injected fault")
+
+// Config is a schedule of faults. The probabilities, from 0 to 1, are drawn
+// once for every file opened or created, so a file either has a fault or
+// works. The draws only depend on the seed, the name of the file and how
+// often it was opened or created before, the same job fails the same way
+// whatever the order its goroutines run in.
+type Config struct {
+	Seed uint64
+	// Match limits the faults to the files it returns true for, nil is all
+	// files. Corrupting lines of an input only changes its words, there is
+	// nothing to detect, so corrupted reads are usually limited to
+	// intermediate files.
+	Match func(name string) bool
+
+	// OpenError fails OpenInputFile.
+	OpenError float64
+	// CreateError fails CreateOutputFile.
+	CreateError float64
+	// WriteError fails a write once the file holds a random number of bytes
+	// below WriteErrorAfter, the bytes before it are written.
+	WriteError      float64
+	WriteErrorAfter int64
+	// ShortWrite writes only the first half of a random write and fails it
+	// with io.ErrShortWrite.
+	ShortWrite float64
+	// CloseError fails Close after the file is closed.
+	CloseError float64
+	// ReadError stops reading a file at a random one of its first lines, the
+	// file reports the error from Err.
+	ReadError float64
+	// CorruptRead garbles the last byte of a random one of the first lines of
+	// a file.
+	CorruptRead float64
+	// Latency delays every open, create and close by a random duration below
+	// it.
+	Latency time.Duration
+}
+
+// faultLines is how many of the first lines of a file a read fault can hit,
+// and how many of the first writes a short write can.
+const faultLines = 16
+
+// Storage is a Storage that injects the faults of its Config into the files
+// of another one. It is safe for concurrent use.
+type Storage struct {
+	storage mapReduceDomain.Storage
+	config  Config
+
+	mu       sync.Mutex
+	uses     map[string]uint64
+	injected []string
+}
+
+func NewStorage(storage mapReduceDomain.Storage, config Config) *Storage {
+	return &Storage{storage: storage, config: config, uses: make(map[string]uint64)}
+}
+
+// Injected describes the faults injected so far, in the order they hit.
+func (s *Storage) Injected() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	injected := make([]string, len(s.injected))
+	copy(injected, s.injected)
+	return injected
+}
+
+func (s *Storage) OpenInputFile(name string) (mapReduceDomain.InputFile, error) {
+	r := s.rand(name)
+	s.delay(r)
+	if s.hits(r, name, s.config.OpenError) {
+		return nil, s.inject("open %s", name)
+	}
+	input, err := s.storage.OpenInputFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &inputFile{InputFile: input, storage: s, name: name, rand: r, readErrorAt: -1, corruptAt: -1}
+	if s.hits(r, name, s.config.ReadError) {
+		f.readErrorAt = r.IntN(faultLines)
+	}
+	if s.hits(r, name, s.config.CorruptRead) {
+		f.corruptAt = r.IntN(faultLines)
+	}
+	f.closeError = s.hits(r, name, s.config.CloseError)
+	return f, nil
+}
+
+func (s *Storage) CreateOutputFile(name string) (mapReduceDomain.OutputFile, error) {
+	r := s.rand(name)
+	s.delay(r)
+	if s.hits(r, name, s.config.CreateError) {
+		return nil, s.inject("create %s", name)
+	}
+	output, err := s.storage.CreateOutputFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &outputFile{output: output, storage: s, name: name, rand: r, failAt: -1, shortAt: -1}
+	if s.hits(r, name, s.config.WriteError) && s.config.WriteErrorAfter > 0 {
+		f.failAt = r.Int64N(s.config.WriteErrorAfter)
+	}
+	if s.hits(r, name, s.config.ShortWrite) {
+		f.shortAt = r.IntN(faultLines)
+	}
+	f.closeError = s.hits(r, name, s.config.CloseError)
+	return f, nil
+}
+
+// RemoveFile removes the file from the wrapped storage, it never fails by a
+// fault: cleaning up is what the faults test.
+func (s *Storage) RemoveFile(name string) error {
+	remover, ok := s.storage.(mapReduceDomain.RemoveStorage)
+	if !ok {
+		return fmt.Errorf("storage of %q can't remove files", name)
+	}
+	return remover.RemoveFile(name)
+}
+
+// rand is the source of the faults of the next use of the file.
+func (s *Storage) rand(name string) *rand.Rand {
+	s.mu.Lock()
+	use := s.uses[name]
+	s.uses[name]++
+	s.mu.Unlock()
+
+	return rand.New(rand.NewChaCha8(sha256.Sum256(fmt.Appendf(nil, "%d\x00%s\x00%d", s.config.Seed, name, use))))
+}
+
+// hits draws whether a fault of probability p hits the file. It draws even
+// if Match leaves the file alone, so Match doesn't change which faults the
+// other draws of the file get.
+func (s *Storage) hits(r *rand.Rand, name string, p float64) bool {
+	hit := r.Float64() < p
+	return hit && (s.config.Match == nil || s.config.Match(name))
+}
+
+func (s *Storage) delay(r *rand.Rand) {
+	if s.config.Latency > 0 {
+		time.Sleep(time.Duration(r.Int64N(int64(s.config.Latency))))
+	}
+}
+
+// inject records a fault and returns its error.
+func (s *Storage) inject(format string, args ...any) error {
+	fault := fmt.Sprintf(format, args...)
+	s.mu.Lock()
+	s.injected = append(s.injected, fault)
+	s.mu.Unlock()
+
+	return fmt.Errorf("%w: %s", ErrInjected, fault)
+}
+
+type inputFile struct {
+	mapReduceDomain.InputFile
+	storage     *Storage
+	name        string
+	rand        *rand.Rand
+	line        int
+	readErrorAt int
+	corruptAt   int
+	closeError  bool
+	err         error
+	corrupted   string
+}
+
+func (f *inputFile) Scan() bool {
+	if f.err != nil {
+		return false
+	}
+	if f.line == f.readErrorAt {
+		f.err = f.storage.inject("read %s at line %d", f.name, f.line)
+		return false
+	}
+	if !f.InputFile.Scan() {
+		return false
+	}
+	f.corrupted = ""
+	if f.line == f.corruptAt {
+		line := f.InputFile.ReadLine()
+		if line != "" {
+			f.storage.inject("corrupt %s at line %d", f.name, f.line)
+			f.corrupted = line[:len(line)-1] + "\x00"
+		}
+	}
+	f.line++
+	return true
+}
+
+func (f *inputFile) ReadLine() string {
+	if f.corrupted != "" {
+		return f.corrupted
+	}
+	return f.InputFile.ReadLine()
+}
+
+func (f *inputFile) ReadMappedLine() (string, int64, error) {
+	if f.corrupted != "" {
+		return sourceAdapter.ParseMappedLine(f.corrupted)
+	}
+	return f.InputFile.ReadMappedLine()
+}
+
+func (f *inputFile) ReadRecord() ([]byte, int64, error) {
+	if f.corrupted != "" {
+		return sourceAdapter.ParseRecord([]byte(f.corrupted))
+	}
+	return f.InputFile.ReadRecord()
+}
+
+func (f *inputFile) Err() error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.InputFile.Err()
+}
+
+func (f *inputFile) Close() error {
+	f.storage.delay(f.rand)
+	err := f.InputFile.Close()
+	if f.closeError {
+		return errors.Join(err, f.storage.inject("close %s", f.name))
+	}
+	return err
+}
+
+type outputFile struct {
+	output     mapReduceDomain.OutputFile
+	storage    *Storage
+	name       string
+	rand       *rand.Rand
+	written    int64
+	writes     int
+	failAt     int64
+	shortAt    int
+	closeError bool
+}
+
+func (f *outputFile) Write(line string) error {
+	return f.write(line, func(line string) error {
+		return f.output.Write(line)
+	})
+}
+
+func (f *outputFile) WriteRecord(key []byte, count int64) error {
+	line := string(sourceAdapter.AppendRecord(nil, key, count))
+	return f.write(line, func(string) error {
+		return f.output.WriteRecord(key, count)
+	})
+}
+
+// write writes line with fn, unless a fault cuts it short.
+func (f *outputFile) write(line string, fn func(line string) error) error {
+	defer func() {
+		f.writes++
+	}()
+	if f.failAt >= 0 && f.written+int64(len(line)) > f.failAt {
+		err := f.output.Write(line[:f.failAt-f.written])
+		f.written = f.failAt
+		return errors.Join(err, f.storage.inject("write %s after %d bytes", f.name, f.failAt))
+	}
+	if f.writes == f.shortAt {
+		half := line[:len(line)/2]
+		err := f.output.Write(half)
+		f.written += int64(len(half))
+		return errors.Join(err, fmt.Errorf("%w: %w", f.storage.inject("short write %s", f.name), io.ErrShortWrite))
+	}
+	err := fn(line)
+	if err != nil {
+		return err
+	}
+	f.written += int64(len(line))
+	return nil
+}
+
+func (f *outputFile) Close() error {
+	f.storage.delay(f.rand)
+	err := f.output.Close()
+	if f.closeError {
+		return errors.Join(err, f.storage.inject("close %s", f.name))
+	}
+	return err
+}
@@ -0,0 +1,189 @@
+package fault_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	faultAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/fault"
+	memoryAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/memory"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+func TestStorage_Faults(t *testing.T) {
+	memory := memoryAdapter.NewStorage()
+	memory.Put("in.txt", []byte("a\nb\nc\n"))
+
+	storage := faultAdapter.NewStorage(memory, faultAdapter.Config{OpenError: 1})
+	_, err := storage.OpenInputFile("in.txt")
+	require.ErrorIs(t, err, faultAdapter.ErrInjected)
+
+	storage = faultAdapter.NewStorage(memory, faultAdapter.Config{WriteError: 1, WriteErrorAfter: 1})
+	out, err := storage.CreateOutputFile("out.tsv")
+	require.NoError(t, err)
+	require.ErrorIs(t, out.WriteRecord([]byte("word"), 1), faultAdapter.ErrInjected)
+	require.NoError(t, out.Close())
+	data, _ := memory.Get("out.tsv")
+	assert.Empty(t, data)
+	assert.Equal(t, []string{"write out.tsv after 0 bytes"}, storage.Injected())
+
+	// longer than the lines a fault can hit
+	var sorted strings.Builder
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&sorted, "w%02d\t%d\n", i, i+1)
+	}
+	memory.Put("sorted.tsv", []byte(sorted.String()))
+	storage = faultAdapter.NewStorage(memory, faultAdapter.Config{ReadError: 1, CorruptRead: 1, CloseError: 1,
+		Match: func(name string) bool { return name == "sorted.tsv" }})
+	input, err := storage.OpenInputFile("in.txt")
+	require.NoError(t, err)
+	lines := 0
+	for input.Scan() {
+		lines++
+	}
+	assert.Equal(t, 3, lines)
+	require.NoError(t, input.Err())
+	require.NoError(t, input.Close())
+	assert.Empty(t, storage.Injected(), "Match leaves in.txt alone")
+
+	input, err = storage.OpenInputFile("sorted.tsv")
+	require.NoError(t, err)
+	for input.Scan() {
+		_, _, _ = input.ReadRecord()
+	}
+	assert.NotEmpty(t, storage.Injected())
+	assert.ErrorIs(t, input.Close(), faultAdapter.ErrInjected)
+}
+
+func TestStorage_Deterministic(t *testing.T) {
+	config := faultAdapter.Config{Seed: 7, OpenError: 0.5}
+	run := func() []bool {
+		memory := memoryAdapter.NewStorage()
+		storage := faultAdapter.NewStorage(memory, config)
+		var failed []bool
+		for i := 0; i < 20; i++ {
+			name := fmt.Sprintf("file_%d", i%4)
+			memory.Put(name, nil)
+			_, err := storage.OpenInputFile(name)
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	first := run()
+	assert.Equal(t, first, run())
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+}
+
+// intermediate matches the files a job writes, not its input.
+func intermediate(name string) bool {
+	return name != "input.txt"
+}
+
+// schedules are the kinds of faults the suite runs jobs under, each with many
+// seeds.
+var schedules = map[string]faultAdapter.Config{
+	"open":    {OpenError: 0.05},
+	"create":  {CreateError: 0.05},
+	"write":   {WriteError: 0.1, WriteErrorAfter: 64},
+	"short":   {ShortWrite: 0.05},
+	"close":   {CloseError: 0.05},
+	"read":    {ReadError: 0.1},
+	"corrupt": {CorruptRead: 0.1, Match: intermediate},
+	"latency": {Latency: 50 * time.Microsecond},
+	"all": {OpenError: 0.01, CreateError: 0.01, WriteError: 0.02, WriteErrorAfter: 256, ShortWrite: 0.01,
+		CloseError: 0.01, ReadError: 0.02, CorruptRead: 0.02, Match: intermediate, Latency: 20 * time.Microsecond},
+}
+
+// TestService_Do_Faults runs jobs under many fault schedules, a job must fail
+// or count exactly right, and leave no goroutines or files of a failed job
+// behind. A failing seed is reproduced with -run 'TestService_Do_Faults/<name>/seed=<seed>'.
+func TestService_Do_Faults(t *testing.T) {
+	input, want := faultInput()
+
+	for name, config := range schedules {
+		t.Run(name, func(t *testing.T) {
+			failed := 0
+			for seed := uint64(1); seed <= 40; seed++ {
+				t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+					config := config
+					config.Seed = seed
+					if err := runFaultJob(t, config, input, want); err != nil {
+						failed++
+					}
+				})
+			}
+			t.Logf("%d of 40 jobs failed", failed)
+		})
+	}
+}
+
+// runFaultJob runs a job under the faults of config and checks its outcome,
+// it returns the error of the job.
+func runFaultJob(t *testing.T, config faultAdapter.Config, input, want string) error {
+	goroutines := runtime.NumGoroutine()
+	memory := memoryAdapter.NewStorage()
+	memory.Put("input.txt", []byte(input))
+	storage := faultAdapter.NewStorage(memory, config)
+	svc := mapreduce.NewService(int(config.Seed%31)+10, int(config.Seed%3)+1, storage)
+
+	result, _, err := svc.Do(context.Background(), "input.txt")
+	injected := storage.Injected()
+	if err != nil {
+		// a job without faults must not fail, one with them may
+		require.NotEmpty(t, injected, "job failed without faults: %v", err)
+		assert.Equal(t, []string{"input.txt"}, memory.Names(), "files of a failed job are left behind")
+	} else {
+		data, _ := memory.Get(result)
+		require.Equal(t, want, string(data), "wrong result despite faults %v", injected)
+		for _, name := range memory.Names() {
+			assert.True(t, name == "input.txt" || strings.HasPrefix(name, "temp_") || strings.HasPrefix(name, "merged_"), name)
+		}
+	}
+
+	// not require.Eventually, it runs the check in a goroutine of its own
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), goroutines, "goroutines leaked")
+
+	return err
+}
+
+// faultInput is a random input of a few dozen words and its counts, sorted
+// by word.
+func faultInput() (input, want string) {
+	r := rand.New(rand.NewPCG(1, 2))
+	counts := make(map[string]int)
+	var lines []string
+	for i := 0; i < 120; i++ {
+		word := fmt.Sprintf("w%02d", r.IntN(40))
+		counts[word]++
+		lines = append(lines, word)
+		if r.IntN(10) == 0 {
+			lines = append(lines, "")
+		}
+	}
+
+	words := make([]string, 0, len(counts))
+	for word := range counts {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	var b strings.Builder
+	for _, word := range words {
+		fmt.Fprintf(&b, "%s\t%d\n", word, counts[word])
+	}
+
+	return strings.Join(lines, "\n") + "\n", b.String()
+}
@@ -0,0 +1,163 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	sourceAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/source"
+	mapReduceDomain "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// IsArchive tells if the file name looks like an archive OpenArchive can read.
+func IsArchive(name string) bool {
+	return archiveKind(name) != ""
+}
+
+func archiveKind(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tgz"
+	default:
+		return ""
+	}
+}
+
+// Archive reads members of a zip, tar or gzip compressed tar file as inputs,
+// without extracting them to disk.
+type Archive struct {
+	name    string
+	include []string
+	exclude []string
+}
+
+// OpenArchive prepares reading the archive. Members are filtered with
+// path.Match patterns, matched against the full member name and its base
+// name: with include set only matching members are read, members matching
+// exclude are always skipped.
+func OpenArchive(name string, include, exclude []string) (*Archive, error) {
+	if archiveKind(name) == "" {
+		return nil, fmt.Errorf("%q is not a zip, tar, tar.gz or tgz archive", name)
+	}
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad member pattern %q, error=%w", pattern, err)
+		}
+	}
+
+	return &Archive{name: name, include: include, exclude: exclude}, nil
+}
+
+// Each calls fn for every regular member that passes the filters, in archive order.
+// It has the signature of mapreduce.Inputs.
+func (a *Archive) Each(fn func(name string, input mapReduceDomain.InputFile) error) error {
+	if archiveKind(a.name) == "zip" {
+		return a.eachZip(fn)
+	}
+	return a.eachTar(fn)
+}
+
+func (a *Archive) eachZip(fn func(name string, input mapReduceDomain.InputFile) error) (err error) {
+	reader, err := zip.OpenReader(a.name)
+	if err != nil {
+		return fmt.Errorf("open zip archive failed, error=%w", err)
+	}
+	defer func() {
+		if closeErr := reader.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("close zip archive failed, error=%w", closeErr))
+		}
+	}()
+
+	for _, member := range reader.File {
+		if !member.Mode().IsRegular() || !a.matches(member.Name) {
+			continue
+		}
+		memberFile, err := member.Open()
+		if err != nil {
+			return fmt.Errorf("open zip member %q failed, error=%w", member.Name, err)
+		}
+		input := sourceAdapter.NewInputFile(memberFile)
+		err = errors.Join(fn(member.Name, input), input.Close())
+		if err != nil {
+			return fmt.Errorf("zip member %q failed, error=%w", member.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (a *Archive) eachTar(fn func(name string, input mapReduceDomain.InputFile) error) (err error) {
+	file, err := os.Open(a.name)
+	if err != nil {
+		return fmt.Errorf("open tar archive failed, error=%w", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("close tar archive failed, error=%w", closeErr))
+		}
+	}()
+
+	var stream io.Reader = file
+	if archiveKind(a.name) == "tgz" {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("open gzip stream failed, error=%w", err)
+		}
+		defer func() {
+			if closeErr := gz.Close(); closeErr != nil {
+				err = errors.Join(err, fmt.Errorf("close gzip stream failed, error=%w", closeErr))
+			}
+		}()
+		stream = gz
+	}
+
+	reader := tar.NewReader(stream)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar archive failed, error=%w", err)
+		}
+		if header.Typeflag != tar.TypeReg || !a.matches(header.Name) {
+			continue
+		}
+
+		// tar.Reader is not a Closer, members are read in place
+		err = fn(header.Name, sourceAdapter.NewInputFile(reader))
+		if err != nil {
+			return fmt.Errorf("tar member %q failed, error=%w", header.Name, err)
+		}
+	}
+}
+
+func (a *Archive) matches(name string) bool {
+	if len(a.include) > 0 && !matchAny(a.include, name) {
+		return false
+	}
+	return !matchAny(a.exclude, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
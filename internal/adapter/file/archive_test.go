@@ -0,0 +1,80 @@
+package file_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	fileAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/file"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+var members = []struct{ name, data string }{
+	{"one.txt", "a\nb\n"},
+	{"logs/two.txt", "c\n"},
+	{"logs/skip.log", "d\n"},
+}
+
+func writeZip(t *testing.T, name string) {
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	_, err = w.Create("logs/")
+	require.NoError(t, err)
+	for _, m := range members {
+		mw, err := w.Create(m.name)
+		require.NoError(t, err)
+		_, err = mw.Write([]byte(m.data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+}
+
+func writeTarGz(t *testing.T, name string) {
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	w := tar.NewWriter(gz)
+	require.NoError(t, w.WriteHeader(&tar.Header{Name: "logs/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	for _, m := range members {
+		require.NoError(t, w.WriteHeader(&tar.Header{Name: m.name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(m.data))}))
+		_, err = w.Write([]byte(m.data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, f.Close())
+}
+
+func TestArchive_Each(t *testing.T) {
+	dir := t.TempDir()
+	zipName := filepath.Join(dir, "data.zip")
+	tgzName := filepath.Join(dir, "data.tar.gz")
+	writeZip(t, zipName)
+	writeTarGz(t, tgzName)
+
+	for _, name := range []string{zipName, tgzName} {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			assert.True(t, fileAdapter.IsArchive(name))
+			archive, err := fileAdapter.OpenArchive(name, []string{"*.txt"}, []string{"one.*"})
+			require.NoError(t, err)
+
+			got := make(map[string][]string)
+			err = archive.Each(func(member string, input mapreduce.InputFile) error {
+				for input.Scan() {
+					got[member] = append(got[member], input.ReadLine())
+				}
+				return input.Err()
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, map[string][]string{"logs/two.txt": {"c"}}, got)
+		})
+	}
+}
@@ -2,77 +2,159 @@ package file
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"strconv"
-	"strings"
 
+	sourceAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/source"
 	mapReduceDomain "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
 )
 
 type StorageImpl struct {
+	mmap   bool
+	logger *slog.Logger
+	limit  *byteLimit
 }
 
-func NewStorage() *StorageImpl {
-	return &StorageImpl{}
+// Option configures optional behaviour of the StorageImpl.
+type Option func(*StorageImpl)
+
+// WithMmap makes OpenInputFile memory-map regular files instead of reading
+// them through a buffer. Pipes, devices and empty files are still read the
+// buffered way.
+func WithMmap() Option {
+	return func(s *StorageImpl) {
+		s.mmap = true
+	}
+}
+
+// WithLogger logs opened and created files at debug level.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *StorageImpl) {
+		s.logger = logger
+	}
+}
+
+func NewStorage(opts ...Option) *StorageImpl {
+	s := &StorageImpl{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *StorageImpl) OpenInputFile(name string) (mapReduceDomain.InputFile, error) {
-	return newInputFile(name)
+	if s.mmap {
+		return s.newMmapInputFile(name)
+	}
+	inputFile, err := newInputFile(name)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Debug("input opened", "file", name, "mmap", false)
+
+	return inputFile, nil
 }
 
-func (s *StorageImpl) CreateOutputFile(name string) (mapReduceDomain.OutputFile, error) {
-	return newOutputFile(name)
+// InputSize is the size of the file, for progress reports.
+func (s *StorageImpl) InputSize(name string) (int64, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
 }
 
-type InputFileImpl struct {
-	inputFile    *os.File
-	inputScanner *bufio.Scanner
+// InputVersion is the size and modification time of the file, a manifest
+// only resumes the file it was written for.
+func (s *StorageImpl) InputVersion(name string) (mapReduceDomain.InputVersion, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return mapReduceDomain.InputVersion{}, err
+	}
+	return mapReduceDomain.InputVersion{Size: info.Size(), ModTime: info.ModTime()}, nil
 }
 
-func newInputFile(name string) (*InputFileImpl, error) {
+func (s *StorageImpl) OpenInputFileAt(name string, offset int64) (mapReduceDomain.InputFile, error) {
 	inputFile, err := os.Open(name)
 	if err != nil {
 		return nil, fmt.Errorf("newInputFile filed, error=%w", err)
 	}
-	inputScanner := bufio.NewScanner(inputFile)
+	_, err = inputFile.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("seek input file failed, error=%w", err), inputFile.Close())
+	}
 
-	return &InputFileImpl{
-		inputFile:    inputFile,
-		inputScanner: inputScanner,
-	}, nil
-}
+	s.logger.Debug("input opened", "file", name, "offset", offset)
 
-func (s *InputFileImpl) Close() error {
-	return s.inputFile.Close()
+	return sourceAdapter.NewInputFile(inputFile), nil
 }
 
-func (s *InputFileImpl) Scan() bool {
-	return s.inputScanner.Scan()
+func (s *StorageImpl) CreateOutputFile(name string) (mapReduceDomain.OutputFile, error) {
+	outputFile, err := newOutputFile(name)
+	if err != nil {
+		return nil, err
+	}
+	s.limit.created(name)
+	outputFile.name, outputFile.limit = name, s.limit
+	s.logger.Debug("output created", "file", name)
+
+	return outputFile, nil
 }
 
-func (s *InputFileImpl) ReadLine() string {
-	return s.inputScanner.Text()
+// RemoveFile deletes a file, it is not an error if there is no such file.
+func (s *StorageImpl) RemoveFile(name string) error {
+	err := os.Remove(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove file failed, error=%w", err)
+	}
+	s.limit.removed(name)
+	s.logger.Debug("file removed", "file", name)
+
+	return nil
 }
 
-func (s *InputFileImpl) ReadMappedLine() (string, int, error) {
-	parts := strings.Split(s.ReadLine(), "\t")
-	word := parts[0]
-	count, err := strconv.Atoi(parts[1])
+func newInputFile(name string) (*sourceAdapter.InputFileImpl, error) {
+	inputFile, err := os.Open(name)
 	if err != nil {
-		return "", 0, fmt.Errorf("second part in line should be integer, but was not. Error=%w", err)
+		return nil, fmt.Errorf("newInputFile filed, error=%w", err)
 	}
 
-	return word, count, nil
+	return sourceAdapter.NewInputFile(inputFile), nil
 }
 
-func (s *InputFileImpl) Err() error {
-	return s.inputScanner.Err()
+// newMmapInputFile falls back to newInputFile's buffered reading when the
+// file can't be mapped.
+func (s *StorageImpl) newMmapInputFile(name string) (mapReduceDomain.InputFile, error) {
+	inputFile, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("newInputFile filed, error=%w", err)
+	}
+
+	mapped, err := openMmap(inputFile)
+	if err != nil {
+		s.logger.Debug("input opened", "file", name, "mmap", false, "reason", err)
+		return sourceAdapter.NewInputFile(inputFile), nil
+	}
+	// the mapping stays valid after the descriptor is closed
+	err = inputFile.Close()
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("close input file failed, error=%w", err), mapped.Close())
+	}
+
+	s.logger.Debug("input opened", "file", name, "mmap", true)
+
+	return mapped, nil
 }
 
 type OutputFileImpl struct {
 	file   *os.File
 	writer *bufio.Writer
+	record []byte // reused by WriteRecord
+	name   string
+	limit  *byteLimit
 }
 
 func newOutputFile(fileName string) (*OutputFileImpl, error) {
@@ -89,21 +171,40 @@ func newOutputFile(fileName string) (*OutputFileImpl, error) {
 		nil
 }
 
+// Close flushes the buffered writes and closes the file, it is closed even
+// if the flush fails, e.g. on a full disk.
 func (s *OutputFileImpl) Close() error {
-	err := s.writer.Flush()
+	var err error
+	if flushErr := s.writer.Flush(); flushErr != nil {
+		err = fmt.Errorf("flush output file failed, error=%w", flushErr)
+	}
+	if closeErr := s.file.Close(); closeErr != nil {
+		err = errors.Join(err, fmt.Errorf("close output file failed, error=%w", closeErr))
+	}
+
+	return err
+}
+
+func (s *OutputFileImpl) Write(line string) error {
+	err := s.limit.add(s.name, len(line))
 	if err != nil {
 		return err
 	}
-	err = s.file.Close()
+	_, err = s.writer.WriteString(line)
 	if err != nil {
-		return err
+		return fmt.Errorf("write to file filed, error=%w", err)
 	}
 
 	return nil
 }
 
-func (s *OutputFileImpl) Write(line string) error {
-	_, err := s.writer.Write([]byte(line))
+func (s *OutputFileImpl) WriteRecord(key []byte, count int64) error {
+	s.record = sourceAdapter.AppendRecord(s.record[:0], key, count)
+	err := s.limit.add(s.name, len(s.record))
+	if err != nil {
+		return err
+	}
+	_, err = s.writer.Write(s.record)
 	if err != nil {
 		return fmt.Errorf("write to file filed, error=%w", err)
 	}
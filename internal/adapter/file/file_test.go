@@ -0,0 +1,181 @@
+package file_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	fileAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/file"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// Compare a spill written with fmt.Sprintf lines and with WriteRecord:
+//
+//	go test -bench . -benchmem ./internal/adapter/file
+func BenchmarkOutputFile_Write(b *testing.B) {
+	output, err := fileAdapter.NewStorage().CreateOutputFile(filepath.Join(b.TempDir(), "out.tsv"))
+	require.NoError(b, err)
+	defer output.Close()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := output.Write(fmt.Sprintf("%s\t%d\n", "benchmark", i))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkOutputFile_WriteRecord(b *testing.B) {
+	output, err := fileAdapter.NewStorage().CreateOutputFile(filepath.Join(b.TempDir(), "out.tsv"))
+	require.NoError(b, err)
+	defer output.Close()
+
+	key := []byte("benchmark")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := output.WriteRecord(key, int64(i))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// writeRecords writes a spill of rows distinct words for the read benchmarks.
+func writeRecords(b *testing.B, rows int) string {
+	name := filepath.Join(b.TempDir(), "temp.tsv")
+	var data strings.Builder
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&data, "word%07d\t%d\n", i, i%100+1)
+	}
+	require.NoError(b, os.WriteFile(name, []byte(data.String()), 0o644))
+	return name
+}
+
+func benchmarkRead(b *testing.B, storage mapreduce.Storage, read func(mapreduce.InputFile) error) {
+	name := writeRecords(b, 100_000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		input, err := storage.OpenInputFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for input.Scan() {
+			if err := read(input); err != nil {
+				b.Fatal(err)
+			}
+		}
+		input.Close()
+	}
+}
+
+func BenchmarkInputFile_ReadMappedLine(b *testing.B) {
+	benchmarkRead(b, fileAdapter.NewStorage(), func(input mapreduce.InputFile) error {
+		_, _, err := input.ReadMappedLine()
+		return err
+	})
+}
+
+func BenchmarkInputFile_ReadRecord(b *testing.B) {
+	benchmarkRead(b, fileAdapter.NewStorage(), func(input mapreduce.InputFile) error {
+		_, _, err := input.ReadRecord()
+		return err
+	})
+}
+
+func BenchmarkInputFile_ReadRecord_Mmap(b *testing.B) {
+	benchmarkRead(b, fileAdapter.NewStorage(fileAdapter.WithMmap()), func(input mapreduce.InputFile) error {
+		_, _, err := input.ReadRecord()
+		return err
+	})
+}
+
+func BenchmarkService_Do(b *testing.B) {
+	dir := b.TempDir()
+	name := filepath.Join(dir, "input.txt")
+	var data strings.Builder
+	for i := 0; i < 200_000; i++ {
+		fmt.Fprintf(&data, "w%d\n", i*i%20_011)
+	}
+	require.NoError(b, os.WriteFile(name, []byte(data.String()), 0o644))
+
+	svc := mapreduce.NewService(5_000, 4, fileAdapter.NewStorage(), mapreduce.WithTempDir(dir))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := svc.Do(context.Background(), name)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestOutputFile_Close_FlushFails(t *testing.T) {
+	// writes to /dev/full fail with ENOSPC, like on a full disk
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+	output, err := fileAdapter.NewStorage().CreateOutputFile("/dev/full")
+	require.NoError(t, err)
+
+	// buffered, the disk isn't written until Close
+	require.NoError(t, output.WriteRecord([]byte("word"), 1))
+	err = output.Close()
+	require.ErrorIs(t, err, syscall.ENOSPC)
+	require.ErrorContains(t, err, "flush output file failed")
+}
+
+// mergeFailing fails to create the merged files of a job.
+type mergeFailing struct {
+	*fileAdapter.StorageImpl
+}
+
+func (s mergeFailing) CreateOutputFile(name string) (mapreduce.OutputFile, error) {
+	if strings.Contains(filepath.Base(name), "merged_") {
+		return nil, errors.New("disk full")
+	}
+	return s.StorageImpl.CreateOutputFile(name)
+}
+
+func TestService_Do_ManifestOfRewrittenInput(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "input.txt")
+	manifest := filepath.Join(dir, "job.manifest")
+	require.NoError(t, os.WriteFile(name, []byte("b\na\nb\nc\n\nb\nd\na\n"), 0o644))
+
+	// the job fails after its spills are written, they are kept for a resume
+	svc := mapreduce.NewService(2, 1, mergeFailing{fileAdapter.NewStorage()},
+		mapreduce.WithTempDir(dir), mapreduce.WithManifest(manifest))
+	_, _, err := svc.Do(context.Background(), name)
+	require.ErrorContains(t, err, "disk full")
+	require.FileExists(t, manifest)
+
+	// same size, later modification time
+	before, err := fileAdapter.NewStorage().InputVersion(name)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(name, []byte("e\na\ne\nc\n\ne\nd\na\n"), 0o644))
+	require.NoError(t, os.Chtimes(name, before.ModTime, before.ModTime.Add(time.Second)))
+	after, err := fileAdapter.NewStorage().InputVersion(name)
+	require.NoError(t, err)
+	require.Equal(t, before.Size, after.Size)
+	require.NotEqual(t, before, after)
+
+	storage := fileAdapter.NewStorage()
+	svc = mapreduce.NewService(2, 1, storage, mapreduce.WithTempDir(dir), mapreduce.WithManifest(manifest))
+	result, _, err := svc.Do(context.Background(), name)
+	require.NoError(t, err)
+	got, _ := readLines(t, storage, result)
+	assert.Equal(t, []string{"a\t2", "c\t1", "d\t1", "e\t3"}, got)
+	assert.NoFileExists(t, manifest)
+}
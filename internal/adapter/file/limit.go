@@ -0,0 +1,93 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// ErrMaxBytes is returned by a write that would take the files of the storage
+// over the WithMaxBytes cap.
+var ErrMaxBytes = errors.New("storage size cap exceeded")
+
+// WithMaxBytes caps the bytes of the files the storage writes and hasn't
+// removed yet. A write over the cap fails with ErrMaxBytes, and FreeSpace
+// reports no more than is left under it, so jobs fail before they start a
+// spill or merge that can't fit.
+func WithMaxBytes(n int64) Option {
+	return func(s *StorageImpl) {
+		s.limit = &byteLimit{max: n, sizes: make(map[string]int64)}
+	}
+}
+
+// FreeSpace is how many bytes can still be written next to name: the space
+// of the file system for unprivileged users, and no more than WithMaxBytes
+// leaves.
+func (s *StorageImpl) FreeSpace(name string) (int64, error) {
+	free, err := freeSpace(filepath.Dir(name))
+	if s.limit == nil {
+		return free, err
+	}
+	if errors.Is(err, errors.ErrUnsupported) {
+		return s.limit.free(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return min(free, s.limit.free()), nil
+}
+
+// byteLimit counts bytes written to files by name, a nil byteLimit has no cap.
+type byteLimit struct {
+	mu    sync.Mutex
+	max   int64
+	used  int64
+	sizes map[string]int64
+}
+
+// created forgets the size of a file that is replaced.
+func (l *byteLimit) created(name string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.used -= l.sizes[name]
+	l.sizes[name] = 0
+}
+
+func (l *byteLimit) removed(name string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.used -= l.sizes[name]
+	delete(l.sizes, name)
+}
+
+// add counts n more bytes of the file, or fails if they don't fit.
+func (l *byteLimit) add(name string, n int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.used+int64(n) > l.max {
+		return fmt.Errorf("%w: writing %d bytes to %s, %d of %d bytes are used", ErrMaxBytes, n, name, l.used, l.max)
+	}
+	l.used += int64(n)
+	l.sizes[name] += int64(n)
+	return nil
+}
+
+func (l *byteLimit) free() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return max(l.max-l.used, 0)
+}
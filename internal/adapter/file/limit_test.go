@@ -0,0 +1,91 @@
+package file_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	fileAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/file"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+func TestStorage_WithMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	storage := fileAdapter.NewStorage(fileAdapter.WithMaxBytes(10))
+	name := filepath.Join(dir, "out.tsv")
+
+	free, err := storage.FreeSpace(name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), free)
+
+	out, err := storage.CreateOutputFile(name)
+	require.NoError(t, err)
+	require.NoError(t, out.Write("a\t1\n"))
+	require.NoError(t, out.WriteRecord([]byte("b"), 2))
+	assert.ErrorIs(t, out.Write("c\t3\n"), fileAdapter.ErrMaxBytes)
+	require.NoError(t, out.Close())
+
+	free, err = storage.FreeSpace(name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), free)
+
+	// a removed file gives its bytes back
+	require.NoError(t, storage.RemoveFile(name))
+	free, err = storage.FreeSpace(name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), free)
+}
+
+func TestService_Do_MaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "input.txt")
+	require.NoError(t, os.WriteFile(name, []byte("b\na\nb\nc\n\nb\nd\na\n"), 0o644))
+
+	// the spills fit, merging them doesn't
+	storage := fileAdapter.NewStorage(fileAdapter.WithMaxBytes(20))
+	svc := mapreduce.NewService(2, 1, storage, mapreduce.WithTempDir(dir))
+
+	_, _, err := svc.Do(context.Background(), name)
+	require.ErrorIs(t, err, mapreduce.ErrInsufficientSpace)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "input.txt", entries[0].Name())
+}
+
+func TestService_DoPartitioned_MaxBytes(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+	require.NoError(t, os.WriteFile("input.txt", []byte("b\na\nb\nc\n\nb\nd\na\n"), 0o644))
+
+	// the part files and the index are larger than the cap of the intermediates
+	storage := fileAdapter.NewStorage(fileAdapter.WithMaxBytes(64))
+	svc := mapreduce.NewService(2, 1, storage, mapreduce.WithResultStorage(fileAdapter.NewStorage()))
+	partitioner, err := mapreduce.NewRangePartitioner([]string{"c"})
+	require.NoError(t, err)
+
+	parts, err := svc.DoPartitioned(context.Background(), "input.txt", partitioner)
+	require.NoError(t, err)
+	assert.Len(t, parts, 2)
+
+	var size int
+	for _, name := range []string{"part-00000.tsv", "part-00001.tsv", mapreduce.PartitionIndexFileName} {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		size += len(data)
+	}
+	assert.Greater(t, size, 64)
+	data, err := os.ReadFile("part-00000.tsv")
+	require.NoError(t, err)
+	assert.Equal(t, "a\t2\nb\t3\n", string(data))
+}
@@ -0,0 +1,104 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+
+	sourceAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/source"
+)
+
+// errMmapUnsupported means the file is read through a bufio.Scanner instead.
+var errMmapUnsupported = errors.New("mmap is not supported")
+
+// MmapInputFile scans lines straight from a memory-mapped file. ReadLineBytes
+// returns slices of the mapping, so lines are not copied until the mapper
+// keeps them as new keys.
+type MmapInputFile struct {
+	data []byte
+	pos  int
+	line []byte
+	err  error
+}
+
+// openMmap maps a regular, non-empty file. Pipes, devices and empty files
+// report errMmapUnsupported so the caller falls back to buffered reading.
+func openMmap(file *os.File) (*MmapInputFile, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() || info.Size() == 0 || int64(int(info.Size())) != info.Size() {
+		return nil, errMmapUnsupported
+	}
+
+	data, err := mmap(file, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &MmapInputFile{data: data}, nil
+}
+
+func (s *MmapInputFile) Close() error {
+	if s.data == nil {
+		return nil
+	}
+	data := s.data
+	s.data, s.line = nil, nil
+	return munmap(data)
+}
+
+// Scan splits lines the way bufio.ScanLines does: a trailing \r is dropped
+// and the last line doesn't need a newline. A line that wouldn't fit in the
+// bufio.MaxScanTokenSize buffer of a bufio.Scanner stops it with
+// bufio.ErrTooLong, as it does for buffered reading.
+func (s *MmapInputFile) Scan() bool {
+	if s.err != nil || s.pos >= len(s.data) {
+		s.line = nil
+		return false
+	}
+
+	rest := s.data[s.pos:]
+	end := bytes.IndexByte(rest[:min(len(rest), bufio.MaxScanTokenSize)], '\n')
+	if end < 0 && len(rest) >= bufio.MaxScanTokenSize {
+		s.line = nil
+		s.err = bufio.ErrTooLong
+		return false
+	}
+	if end < 0 {
+		s.line = s.data[s.pos:]
+		s.pos = len(s.data)
+	} else {
+		s.line = s.data[s.pos : s.pos+end]
+		s.pos += end + 1
+	}
+	if n := len(s.line); n > 0 && s.line[n-1] == '\r' {
+		s.line = s.line[:n-1]
+	}
+
+	return true
+}
+
+func (s *MmapInputFile) ReadLine() string {
+	return string(s.line)
+}
+
+// ReadLineBytes returns the current line without copying it, the slice is
+// only valid until Close.
+func (s *MmapInputFile) ReadLineBytes() []byte {
+	return s.line
+}
+
+func (s *MmapInputFile) ReadMappedLine() (string, int64, error) {
+	return sourceAdapter.ParseMappedLine(s.ReadLine())
+}
+
+func (s *MmapInputFile) ReadRecord() ([]byte, int64, error) {
+	return sourceAdapter.ParseRecord(s.line)
+}
+
+func (s *MmapInputFile) Err() error {
+	return s.err
+}
@@ -0,0 +1,29 @@
+//go:build linux
+
+package file
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func mmap(file *os.File, size int) ([]byte, error) {
+	data, err := syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("mmap failed, error=%w", err)
+	}
+	// the mapper reads front to back, let the kernel read ahead aggressively
+	_ = syscall.Madvise(data, syscall.MADV_SEQUENTIAL)
+
+	return data, nil
+}
+
+func munmap(data []byte) error {
+	err := syscall.Munmap(data)
+	if err != nil {
+		return fmt.Errorf("munmap failed, error=%w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package file
+
+import (
+	"os"
+)
+
+func mmap(*os.File, int) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+func munmap([]byte) error {
+	return nil
+}
@@ -0,0 +1,114 @@
+package file_test
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	fileAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/file"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+func readLines(t *testing.T, storage mapreduce.Storage, name string) ([]string, bool) {
+	input, err := storage.OpenInputFile(name)
+	require.NoError(t, err)
+	_, zeroCopy := input.(mapreduce.LineBytesReader)
+
+	var lines []string
+	for input.Scan() {
+		lines = append(lines, input.ReadLine())
+	}
+	require.NoError(t, input.Err())
+	require.NoError(t, input.Close())
+	return lines, zeroCopy
+}
+
+func TestStorage_WithMmap(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		data     string
+		zeroCopy bool
+	}{
+		{"lines", "b\na\r\n\nb\nc", runtime.GOOS == "linux"},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(dir, tt.name+".txt")
+			require.NoError(t, os.WriteFile(name, []byte(tt.data), 0o644))
+
+			want, _ := readLines(t, fileAdapter.NewStorage(), name)
+			got, zeroCopy := readLines(t, fileAdapter.NewStorage(fileAdapter.WithMmap()), name)
+			assert.Equal(t, want, got)
+			assert.Equal(t, tt.zeroCopy, zeroCopy)
+		})
+	}
+}
+
+func TestStorage_WithMmap_LongLines(t *testing.T) {
+	dir := t.TempDir()
+	long := func(n int) string {
+		return strings.Repeat("x", n)
+	}
+	tests := []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{"longest line", "a\n" + long(bufio.MaxScanTokenSize-1) + "\nb\n", nil},
+		{"too long", "a\n" + long(bufio.MaxScanTokenSize) + "\nb\n", bufio.ErrTooLong},
+		{"longest crlf line", long(bufio.MaxScanTokenSize-2) + "\r\n", nil},
+		{"too long crlf", long(bufio.MaxScanTokenSize-1) + "\r\n", bufio.ErrTooLong},
+		{"longest last line", "a\n" + long(bufio.MaxScanTokenSize-1), nil},
+		{"too long last line", "a\n" + long(bufio.MaxScanTokenSize), bufio.ErrTooLong},
+	}
+
+	// scan counts the lines before the error, if any
+	scan := func(storage mapreduce.Storage, name string) (int, error) {
+		input, err := storage.OpenInputFile(name)
+		require.NoError(t, err)
+		defer input.Close()
+		lines := 0
+		for input.Scan() {
+			lines++
+		}
+		return lines, input.Err()
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_")+".txt")
+			require.NoError(t, os.WriteFile(name, []byte(tt.data), 0o644))
+
+			wantLines, err := scan(fileAdapter.NewStorage(), name)
+			require.Equal(t, tt.wantErr, err, "buffered reading")
+			lines, err := scan(fileAdapter.NewStorage(fileAdapter.WithMmap()), name)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, wantLines, lines)
+		})
+	}
+}
+
+func TestService_DoTo_Mmap(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "input.txt")
+	require.NoError(t, os.WriteFile(name, []byte("b\na\nb\nc\n\nb\nd\na\n"), 0o644))
+
+	storage := fileAdapter.NewStorage(fileAdapter.WithMmap())
+	// N=2 spills several times, so interned keys must survive being cleared
+	svc := mapreduce.NewService(2, 2, storage, mapreduce.WithTempDir(dir))
+
+	result, _, err := svc.Do(context.Background(), name)
+	require.NoError(t, err)
+	got, _ := readLines(t, storage, result)
+	assert.Equal(t, []string{"a\t2", "b\t3", "c\t1", "d\t1"}, got)
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+package file
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// freeSpace is the space of the file system of dir that unprivileged users can use.
+func freeSpace(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return 0, fmt.Errorf("statfs failed, error=%w", err)
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
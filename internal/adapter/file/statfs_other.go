@@ -0,0 +1,10 @@
+//go:build !linux
+
+package file
+
+import "errors"
+
+// freeSpace is unsupported, the file system isn't asked on this platform.
+func freeSpace(string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,142 @@
+package memory
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+
+	sourceAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/source"
+	mapReduceDomain "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// StorageImpl keeps files in memory, it is safe for concurrent use.
+// An output file becomes visible to readers when it is closed.
+type StorageImpl struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+func NewStorage() *StorageImpl {
+	return &StorageImpl{
+		files: make(map[string][]byte),
+	}
+}
+
+// Put creates or replaces a file.
+func (s *StorageImpl) Put(name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = data
+}
+
+// Get returns the content of a file.
+func (s *StorageImpl) Get(name string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.files[name]
+	return data, ok
+}
+
+// Remove deletes a file, it is not an error if there is no such file.
+func (s *StorageImpl) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, name)
+}
+
+// RemoveFile is Remove for jobs cleaning up their intermediate files.
+func (s *StorageImpl) RemoveFile(name string) error {
+	s.Remove(name)
+	return nil
+}
+
+// Names returns sorted names of all files.
+func (s *StorageImpl) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *StorageImpl) OpenInputFile(name string) (mapReduceDomain.InputFile, error) {
+	return s.OpenInputFileAt(name, 0)
+}
+
+// InputSize is the size of the file, for progress reports.
+func (s *StorageImpl) InputSize(name string) (int64, error) {
+	data, ok := s.Get(name)
+	if !ok {
+		return 0, fmt.Errorf("file %q does not exist", name)
+	}
+	return int64(len(data)), nil
+}
+
+// InputVersion is the size of the file and, without modification times to
+// tell rewrites apart, a hash of its content as the ETag.
+func (s *StorageImpl) InputVersion(name string) (mapReduceDomain.InputVersion, error) {
+	data, ok := s.Get(name)
+	if !ok {
+		return mapReduceDomain.InputVersion{}, fmt.Errorf("file %q does not exist", name)
+	}
+	sum := sha256.Sum256(data)
+	return mapReduceDomain.InputVersion{Size: int64(len(data)), ETag: hex.EncodeToString(sum[:])}, nil
+}
+
+func (s *StorageImpl) OpenInputFileAt(name string, offset int64) (mapReduceDomain.InputFile, error) {
+	data, ok := s.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("newInputFile filed, error=file %q does not exist", name)
+	}
+	if offset < 0 || offset > int64(len(data)) {
+		return nil, fmt.Errorf("newInputFile filed, error=offset %d is out of file %q of %d bytes", offset, name, len(data))
+	}
+
+	return sourceAdapter.NewInputFile(bytes.NewReader(data[offset:])), nil
+}
+
+func (s *StorageImpl) CreateOutputFile(name string) (mapReduceDomain.OutputFile, error) {
+	s.Put(name, nil)
+	return &OutputFileImpl{storage: s, name: name}, nil
+}
+
+type OutputFileImpl struct {
+	storage *StorageImpl
+	name    string
+	buf     bytes.Buffer
+	closed  bool
+}
+
+func (s *OutputFileImpl) Close() error {
+	if s.closed {
+		return fmt.Errorf("file %q is already closed", s.name)
+	}
+	s.closed = true
+	s.storage.Put(s.name, s.buf.Bytes())
+
+	return nil
+}
+
+func (s *OutputFileImpl) Write(line string) error {
+	if s.closed {
+		return fmt.Errorf("write to file filed, error=file %q is closed", s.name)
+	}
+	s.buf.WriteString(line)
+
+	return nil
+}
+
+func (s *OutputFileImpl) WriteRecord(key []byte, count int64) error {
+	if s.closed {
+		return fmt.Errorf("write to file filed, error=file %q is closed", s.name)
+	}
+	s.buf.Write(sourceAdapter.AppendRecord(s.buf.AvailableBuffer(), key, count))
+
+	return nil
+}
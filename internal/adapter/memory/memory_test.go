@@ -0,0 +1,126 @@
+package memory_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memoryAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/memory"
+	mapReduceDomain "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+func readLines(t *testing.T, input mapReduceDomain.InputFile) []string {
+	t.Helper()
+	var lines []string
+	for input.Scan() {
+		lines = append(lines, input.ReadLine())
+	}
+	require.NoError(t, input.Err())
+	require.NoError(t, input.Close())
+	return lines
+}
+
+func TestStorage_Files(t *testing.T) {
+	storage := memoryAdapter.NewStorage()
+	storage.Put("b.txt", []byte("b\n"))
+	storage.Put("a.txt", []byte("a\n"))
+	assert.Equal(t, []string{"a.txt", "b.txt"}, storage.Names())
+
+	data, ok := storage.Get("a.txt")
+	assert.True(t, ok)
+	assert.Equal(t, "a\n", string(data))
+	_, ok = storage.Get("c.txt")
+	assert.False(t, ok)
+
+	storage.Put("a.txt", []byte("x\ny\n"))
+	input, err := storage.OpenInputFile("a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"x", "y"}, readLines(t, input))
+	input, err = storage.OpenInputFileAt("a.txt", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"y"}, readLines(t, input))
+	_, err = storage.OpenInputFileAt("a.txt", 5)
+	assert.Error(t, err)
+	size, err := storage.InputSize("a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), size)
+	version, err := storage.InputVersion("a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), version.Size)
+	storage.Put("a.txt", []byte("x\nz\n"))
+	rewritten, err := storage.InputVersion("a.txt")
+	require.NoError(t, err)
+	assert.NotEqual(t, version, rewritten)
+
+	storage.Remove("a.txt")
+	storage.Remove("a.txt")
+	require.NoError(t, storage.RemoveFile("b.txt"))
+	require.NoError(t, storage.RemoveFile("b.txt"))
+	assert.Empty(t, storage.Names())
+	_, err = storage.OpenInputFile("a.txt")
+	assert.Error(t, err)
+	_, err = storage.InputSize("b.txt")
+	assert.Error(t, err)
+}
+
+func TestStorage_ReadWhileWriting(t *testing.T) {
+	storage := memoryAdapter.NewStorage()
+	storage.Put("out.tsv", []byte("old\t1\n"))
+
+	out, err := storage.CreateOutputFile("out.tsv")
+	require.NoError(t, err)
+	require.NoError(t, out.Write("a\t1\n"))
+	require.NoError(t, out.WriteRecord([]byte("b"), 2))
+
+	// the file is empty until it is closed
+	input, err := storage.OpenInputFile("out.tsv")
+	require.NoError(t, err)
+	assert.Empty(t, readLines(t, input))
+
+	input, err = storage.OpenInputFile("out.tsv")
+	require.NoError(t, err)
+	require.NoError(t, out.Close())
+	assert.Empty(t, readLines(t, input), "a reader keeps the content it was opened on")
+
+	input, err = storage.OpenInputFile("out.tsv")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a\t1", "b\t2"}, readLines(t, input))
+
+	assert.Error(t, out.Write("c\t3\n"))
+	assert.Error(t, out.WriteRecord([]byte("c"), 3))
+	assert.Error(t, out.Close())
+}
+
+func TestStorage_ConcurrentCreate(t *testing.T) {
+	storage := memoryAdapter.NewStorage()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				name := fmt.Sprintf("temp_%d_%d.tsv", i, j)
+				out, err := storage.CreateOutputFile(name)
+				assert.NoError(t, err)
+				assert.NoError(t, out.WriteRecord([]byte(name), int64(j)))
+				assert.NoError(t, out.Close())
+
+				input, err := storage.OpenInputFile(name)
+				assert.NoError(t, err)
+				assert.True(t, input.Scan())
+				key, count, err := input.ReadRecord()
+				assert.NoError(t, err)
+				assert.Equal(t, name, string(key))
+				assert.Equal(t, int64(j), count)
+				assert.NoError(t, input.Close())
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, storage.Names(), 16*50)
+}
@@ -0,0 +1,85 @@
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	mapReduceDomain "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type metric struct {
+	name  string
+	kind  string // counter or gauge
+	help  string
+	value func(v mapReduceDomain.MetricValues) []sample
+}
+
+type sample struct {
+	labels string // {name="value"} or empty
+	value  float64
+}
+
+func single(value int64) []sample {
+	return []sample{{value: float64(value)}}
+}
+
+var metrics = []metric{
+	{"wordcount_lines_total", "counter", "Lines read by the map phase.",
+		func(v mapReduceDomain.MetricValues) []sample { return single(v.Lines) }},
+	{"wordcount_words_total", "counter", "Non-empty lines counted as words.",
+		func(v mapReduceDomain.MetricValues) []sample { return single(v.Words) }},
+	{"wordcount_unique_keys", "gauge", "Unique words counted in memory and not spilled yet.",
+		func(v mapReduceDomain.MetricValues) []sample { return single(v.UniqueKeys) }},
+	{"wordcount_spill_files_total", "counter", "Sorted temp files written by the map phase.",
+		func(v mapReduceDomain.MetricValues) []sample { return single(v.SpillFiles) }},
+	{"wordcount_spill_bytes_total", "counter", "Bytes written to spilled temp files.",
+		func(v mapReduceDomain.MetricValues) []sample { return single(v.SpillBytes) }},
+	{"wordcount_merges_total", "counter", "K-way merges of sorted files.",
+		func(v mapReduceDomain.MetricValues) []sample { return single(v.Merges) }},
+	{"wordcount_merge_fan_in", "gauge", "Files read by the latest merge.",
+		func(v mapReduceDomain.MetricValues) []sample { return single(v.MergeFanIn) }},
+	{"wordcount_active_workers", "gauge", "Merge workers running.",
+		func(v mapReduceDomain.MetricValues) []sample { return single(v.ActiveWorkers) }},
+	{"wordcount_phase_seconds_total", "counter", "Time spent in finished map and reduce phases.",
+		func(v mapReduceDomain.MetricValues) []sample {
+			return []sample{
+				{`{phase="map"}`, v.MapDuration.Seconds()},
+				{`{phase="reduce"}`, v.ReduceDuration.Seconds()},
+			}
+		}},
+	{"wordcount_errors_total", "counter", "Failed map and reduce phases.",
+		func(v mapReduceDomain.MetricValues) []sample {
+			return []sample{
+				{`{phase="map"}`, float64(v.MapErrors)},
+				{`{phase="reduce"}`, float64(v.ReduceErrors)},
+			}
+		}},
+}
+
+// Write writes the values in the Prometheus text exposition format.
+func Write(w io.Writer, values mapReduceDomain.MetricValues) error {
+	out := bufio.NewWriter(w)
+	for _, m := range metrics {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, s := range m.value(values) {
+			fmt.Fprintf(out, "%s%s %s\n", m.name, s.labels, strconv.FormatFloat(s.value, 'f', -1, 64))
+		}
+	}
+
+	return out.Flush()
+}
+
+// NewHandler serves the current values of metrics for Prometheus to scrape.
+func NewHandler(metrics *mapReduceDomain.Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		// a failed write means the scraper went away, there is no one to tell
+		_ = Write(w, metrics.Values())
+	})
+}
@@ -0,0 +1,74 @@
+package prometheus_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memoryAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/memory"
+	prometheusAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/prometheus"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+var sampleLine = regexp.MustCompile(`^([a-z_]+)(\{[a-z]+="[a-z]+"\})? (\S+)$`)
+
+// scrape parses the exposition, checking every sample is preceded by its TYPE.
+func scrape(t *testing.T, handler http.Handler) map[string]string {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, prometheusAdapter.ContentType, rec.Header().Get("Content-Type"))
+
+	samples := make(map[string]string)
+	typed := make(map[string]bool)
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# TYPE ") {
+			typed[strings.Fields(line)[2]] = true
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		m := sampleLine.FindStringSubmatch(line)
+		require.NotNil(t, m, line)
+		assert.True(t, typed[m[1]], "sample before TYPE: %s", line)
+		samples[m[1]+m[2]] = m[3]
+	}
+
+	return samples
+}
+
+func TestHandler(t *testing.T) {
+	storage := memoryAdapter.NewStorage()
+	storage.Put("input.txt", []byte("b\na\nb\nc\n\nb\nd\na\n"))
+	metrics := mapreduce.NewMetrics()
+	svc := mapreduce.NewService(2, 2, storage, mapreduce.WithMetrics(metrics))
+
+	_, _, err := svc.Do(context.Background(), "input.txt")
+	require.NoError(t, err)
+	_, _, err = svc.Do(context.Background(), "missing.txt")
+	require.Error(t, err)
+
+	samples := scrape(t, prometheusAdapter.NewHandler(metrics))
+	assert.Equal(t, "8", samples["wordcount_lines_total"])
+	assert.Equal(t, "7", samples["wordcount_words_total"])
+	assert.Equal(t, "0", samples["wordcount_unique_keys"])
+	assert.Equal(t, "4", samples["wordcount_spill_files_total"])
+	// a 1, b 2 | b 1, c 1 | b 1, d 1 | a 1
+	assert.Equal(t, "28", samples["wordcount_spill_bytes_total"])
+	assert.Equal(t, "3", samples["wordcount_merges_total"])
+	assert.Equal(t, "2", samples["wordcount_merge_fan_in"])
+	assert.Equal(t, "0", samples["wordcount_active_workers"])
+	assert.Equal(t, "1", samples[`wordcount_errors_total{phase="map"}`])
+	assert.Equal(t, "0", samples[`wordcount_errors_total{phase="reduce"}`])
+	assert.Contains(t, samples, `wordcount_phase_seconds_total{phase="reduce"}`)
+}
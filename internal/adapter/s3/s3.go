@@ -0,0 +1,613 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	sourceAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/source"
+	mapReduceDomain "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+const (
+	// DefaultPartSize is the multipart upload part size, S3 needs at least 5 MiB.
+	DefaultPartSize = 8 << 20
+	// DefaultChunkSize is the size of one ranged GET when reading an object.
+	DefaultChunkSize = 8 << 20
+	// DefaultRetries is how many attempts in total a request gets, the first
+	// one included.
+	DefaultRetries = 3
+)
+
+// Config of an S3-compatible object store. Buckets are addressed path-style,
+// http://endpoint/bucket/key, which works with AWS and the usual stand-ins.
+type Config struct {
+	// Endpoint is e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+	PartSize  int
+	ChunkSize int64
+	// Retries is how many attempts in total a request gets, the first one
+	// included.
+	Retries int
+	Client  *http.Client
+	// Context stops the waits between retries when it is cancelled, nil
+	// never does. Requests are sent without it, so a cancelled job can still
+	// remove its objects.
+	Context context.Context
+}
+
+// StorageImpl keeps inputs, intermediates and results as objects. Names are
+// s3://bucket/key URLs.
+type StorageImpl struct {
+	cfg      Config
+	endpoint *url.URL
+}
+
+func NewStorage(cfg Config) (*StorageImpl, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("bad s3 endpoint %q, error=%v", cfg.Endpoint, err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.PartSize <= 0 {
+		cfg.PartSize = DefaultPartSize
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = DefaultChunkSize
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = DefaultRetries
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Context == nil {
+		cfg.Context = context.Background()
+	}
+
+	return &StorageImpl{cfg: cfg, endpoint: endpoint}, nil
+}
+
+// IsURL tells if the name is an s3://bucket/key URL.
+func IsURL(name string) bool {
+	return strings.HasPrefix(name, "s3://")
+}
+
+type location struct {
+	bucket string
+	key    string
+}
+
+func parseURL(name string) (location, error) {
+	if !IsURL(name) {
+		return location{}, fmt.Errorf("%q is not an s3://bucket/key url", name)
+	}
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(name, "s3://"), "/")
+	if !ok || bucket == "" || key == "" {
+		return location{}, fmt.Errorf("%q is not an s3://bucket/key url", name)
+	}
+	return location{bucket: bucket, key: key}, nil
+}
+
+func (s *StorageImpl) OpenInputFile(name string) (mapReduceDomain.InputFile, error) {
+	return s.OpenInputFileAt(name, 0)
+}
+
+// OpenInputFileAt streams the object from offset with ranged GETs of ChunkSize,
+// a dropped connection only repeats one chunk.
+func (s *StorageImpl) OpenInputFileAt(name string, offset int64) (mapReduceDomain.InputFile, error) {
+	loc, err := parseURL(name)
+	if err != nil {
+		return nil, fmt.Errorf("newInputFile filed, error=%w", err)
+	}
+	reader := &objectReader{storage: s, loc: loc, offset: offset, size: -1}
+	// fetch the first chunk now, so a missing object fails on open
+	err = reader.fetch()
+	if err != nil {
+		return nil, fmt.Errorf("newInputFile filed, error=%w", err)
+	}
+
+	return sourceAdapter.NewInputFile(reader), nil
+}
+
+// InputVersion is the size and ETag of the object.
+func (s *StorageImpl) InputVersion(name string) (mapReduceDomain.InputVersion, error) {
+	loc, err := parseURL(name)
+	if err != nil {
+		return mapReduceDomain.InputVersion{}, fmt.Errorf("head object failed, error=%w", err)
+	}
+	resp, err := s.do(http.MethodHead, loc, nil, nil, nil)
+	if err != nil {
+		return mapReduceDomain.InputVersion{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return mapReduceDomain.InputVersion{}, responseError(http.MethodHead, loc, resp)
+	}
+	resp.Body.Close()
+
+	return mapReduceDomain.InputVersion{Size: resp.ContentLength, ETag: resp.Header.Get("ETag")}, nil
+}
+
+func (s *StorageImpl) CreateOutputFile(name string) (mapReduceDomain.OutputFile, error) {
+	loc, err := parseURL(name)
+	if err != nil {
+		return nil, fmt.Errorf("newOutputFile filed, error=%w", err)
+	}
+	return &OutputFileImpl{storage: s, loc: loc}, nil
+}
+
+// RemoveFile deletes the object, it is not an error if there is no such object.
+func (s *StorageImpl) RemoveFile(name string) error {
+	loc, err := parseURL(name)
+	if err != nil {
+		return fmt.Errorf("remove object failed, error=%w", err)
+	}
+	resp, err := s.do(http.MethodDelete, loc, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return responseError(http.MethodDelete, loc, resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *StorageImpl) objectURL(loc location, query url.Values) *url.URL {
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+	u.Path = base + "/" + loc.bucket + "/" + loc.key
+	u.RawPath = base + "/" + escapePath(loc.bucket) + "/" + escapePath(loc.key)
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+	return &u
+}
+
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// do sends a signed request, repeating it on network errors and 5xx
+// responses with exponential backoff. The caller closes the response body.
+func (s *StorageImpl) do(method string, loc location, query url.Values, header http.Header, body []byte) (resp *http.Response, err error) {
+	err = s.retry(func() (again bool, err error) {
+		resp, again, err = s.send(method, loc, query, header, body)
+		return again, err
+	})
+	return resp, err
+}
+
+// retry calls attempt until it succeeds, fails in a way again says isn't
+// worth repeating, or fails Retries times, with exponential backoff between
+// the attempts. Cancelling the Context of the config stops the backoff.
+func (s *StorageImpl) retry(attempt func() (again bool, err error)) error {
+	var err error
+	for i := 0; i < s.cfg.Retries; i++ {
+		if i > 0 {
+			waitErr := s.wait(time.Duration(100<<(i-1)) * time.Millisecond)
+			if waitErr != nil {
+				return errors.Join(err, waitErr)
+			}
+		}
+
+		var again bool
+		again, err = attempt()
+		if err == nil || !again {
+			return err
+		}
+	}
+
+	return err
+}
+
+// wait sleeps before a retry unless the Context of the config is cancelled
+// first.
+func (s *StorageImpl) wait(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-s.cfg.Context.Done():
+		return fmt.Errorf("context cancelled, err if any=%w", s.cfg.Context.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// send sends a signed request once. A network error or a 5xx response is an
+// error worth sending the request again for.
+func (s *StorageImpl) send(method string, loc location, query url.Values, header http.Header, body []byte) (_ *http.Response, again bool, _ error) {
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		payloadHash = sha256Hex(body)
+	}
+
+	req, err := http.NewRequest(method, s.objectURL(loc, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, false, fmt.Errorf("create s3 request failed, error=%w", err)
+	}
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.signV4(req, payloadHash, time.Now())
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("s3 %s s3://%s/%s failed, error=%w", method, loc.bucket, loc.key, err)
+	}
+	if resp.StatusCode >= 500 {
+		return nil, true, responseError(method, loc, resp)
+	}
+	return resp, false, nil
+}
+
+// responseError reads the S3 error document of a failed response and closes its body.
+func responseError(method string, loc location, resp *http.Response) error {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(body, &s3Err) == nil && s3Err.Code != "" {
+		return fmt.Errorf("s3 %s s3://%s/%s failed, status=%s, code=%s, message=%s", method, loc.bucket, loc.key, resp.Status, s3Err.Code, s3Err.Message)
+	}
+	return fmt.Errorf("s3 %s s3://%s/%s failed, status=%s", method, loc.bucket, loc.key, resp.Status)
+}
+
+// objectReader reads an object chunk by chunk with ranged GETs. A server
+// that ignores ranges sends the whole object at once, its body is streamed.
+type objectReader struct {
+	storage *StorageImpl
+	loc     location
+	offset  int64 // of the next chunk to fetch
+	size    int64 // -1 until the first response tells it
+	buf     []byte
+	body    io.ReadCloser // of the whole object when the range was ignored
+}
+
+func (r *objectReader) Read(p []byte) (int, error) {
+	if r.body != nil {
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if err != nil && !errors.Is(err, io.EOF) {
+			// ranges don't work, there is no resuming
+			return n, fmt.Errorf("read s3 object s3://%s/%s failed at byte %d, error=%w", r.loc.bucket, r.loc.key, r.offset, err)
+		}
+		return n, err
+	}
+
+	for len(r.buf) == 0 {
+		if r.size >= 0 && r.offset >= r.size {
+			return 0, io.EOF
+		}
+		if err := r.fetch(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *objectReader) Close() error {
+	if r.body != nil {
+		return r.body.Close()
+	}
+	return nil
+}
+
+func (r *objectReader) fetch() error {
+	if r.size >= 0 && r.offset >= r.size {
+		return nil
+	}
+	end := r.offset + r.storage.cfg.ChunkSize - 1
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", r.offset, end)}}
+
+	return r.storage.retry(func() (bool, error) {
+		resp, again, err := r.storage.send(http.MethodGet, r.loc, nil, header, nil)
+		if err != nil {
+			return again, err
+		}
+
+		switch resp.StatusCode {
+		case http.StatusRequestedRangeNotSatisfiable:
+			// range starts at or after the end of the object, e.g. an empty object
+			resp.Body.Close()
+			r.size = r.offset
+			return false, nil
+		case http.StatusOK:
+			// the server ignored the range and sends the whole object
+			if r.offset > 0 {
+				resp.Body.Close()
+				return false, fmt.Errorf("s3 GET s3://%s/%s can't continue from byte %d, the server ignored the range", r.loc.bucket, r.loc.key, r.offset)
+			}
+			r.body = resp.Body
+			return false, nil
+		case http.StatusPartialContent:
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				// connection dropped in the middle of the chunk, ask for it again
+				return true, fmt.Errorf("read s3 object failed, error=%w", err)
+			}
+			if size, ok := totalSize(resp.Header.Get("Content-Range")); ok {
+				r.size = size
+			}
+			r.buf = body
+			r.offset += int64(len(body))
+			if len(body) == 0 && r.size < 0 {
+				r.size = r.offset
+			}
+			return false, nil
+		default:
+			return false, responseError(http.MethodGet, r.loc, resp)
+		}
+	})
+}
+
+// totalSize parses the size out of "bytes 0-99/1234".
+func totalSize(contentRange string) (int64, bool) {
+	_, total, ok := strings.Cut(contentRange, "/")
+	if !ok || total == "*" {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	return size, err == nil
+}
+
+// OutputFileImpl buffers writes and uploads them as parts of a multipart
+// upload once PartSize is collected. Small objects are uploaded with a single
+// PUT on Close. The object only appears when Close succeeds.
+type OutputFileImpl struct {
+	storage  *StorageImpl
+	loc      location
+	buf      bytes.Buffer
+	uploadID string
+	parts    []completedPart
+	closed   bool
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (s *OutputFileImpl) Write(line string) error {
+	if s.closed {
+		return fmt.Errorf("write to file filed, error=s3://%s/%s is closed", s.loc.bucket, s.loc.key)
+	}
+	s.buf.WriteString(line)
+	return s.flushPart()
+}
+
+func (s *OutputFileImpl) WriteRecord(key []byte, count int64) error {
+	if s.closed {
+		return fmt.Errorf("write to file filed, error=s3://%s/%s is closed", s.loc.bucket, s.loc.key)
+	}
+	s.buf.Write(sourceAdapter.AppendRecord(s.buf.AvailableBuffer(), key, count))
+	return s.flushPart()
+}
+
+// flushPart uploads the buffer as a part once it reaches the part size.
+func (s *OutputFileImpl) flushPart() error {
+	if s.buf.Len() < s.storage.cfg.PartSize {
+		return nil
+	}
+
+	err := s.uploadPart()
+	if err != nil {
+		return fmt.Errorf("write to file filed, error=%w", errors.Join(err, s.abort()))
+	}
+	return nil
+}
+
+func (s *OutputFileImpl) Close() error {
+	if s.closed {
+		return fmt.Errorf("s3://%s/%s is already closed", s.loc.bucket, s.loc.key)
+	}
+	s.closed = true
+
+	if s.uploadID == "" {
+		resp, err := s.storage.do(http.MethodPut, s.loc, nil, nil, s.buf.Bytes())
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return responseError(http.MethodPut, s.loc, resp)
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	if s.buf.Len() > 0 {
+		if err := s.uploadPart(); err != nil {
+			return errors.Join(err, s.abort())
+		}
+	}
+	if err := s.complete(); err != nil {
+		return errors.Join(err, s.abort())
+	}
+	return nil
+}
+
+func (s *OutputFileImpl) uploadPart() error {
+	if s.uploadID == "" {
+		uploadID, err := s.create()
+		if err != nil {
+			return err
+		}
+		s.uploadID = uploadID
+	}
+
+	partNumber := len(s.parts) + 1
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {s.uploadID}}
+	resp, err := s.storage.do(http.MethodPut, s.loc, query, nil, s.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return responseError(http.MethodPut, s.loc, resp)
+	}
+	resp.Body.Close()
+
+	s.parts = append(s.parts, completedPart{PartNumber: partNumber, ETag: resp.Header.Get("ETag")})
+	s.buf.Reset()
+	return nil
+}
+
+func (s *OutputFileImpl) create() (string, error) {
+	resp, err := s.storage.do(http.MethodPost, s.loc, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", responseError(http.MethodPost, s.loc, resp)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&result)
+	if err != nil || result.UploadID == "" {
+		return "", fmt.Errorf("bad create multipart upload response for s3://%s/%s, error=%v", s.loc.bucket, s.loc.key, err)
+	}
+	return result.UploadID, nil
+}
+
+func (s *OutputFileImpl) complete() error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: s.parts})
+	if err != nil {
+		return fmt.Errorf("marshal complete multipart upload failed, error=%w", err)
+	}
+
+	resp, err := s.storage.do(http.MethodPost, s.loc, url.Values{"uploadId": {s.uploadID}}, nil, body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return responseError(http.MethodPost, s.loc, resp)
+	}
+	defer resp.Body.Close()
+
+	// S3 may report a failed completion with 200 and an error document
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read complete multipart upload response failed, error=%w", err)
+	}
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(respBody, &result) == nil && result.XMLName.Local == "Error" {
+		return fmt.Errorf("complete multipart upload of s3://%s/%s failed, code=%s, message=%s", s.loc.bucket, s.loc.key, result.Code, result.Message)
+	}
+	return nil
+}
+
+// abort drops uploaded parts, so a failed output doesn't leave them billed.
+func (s *OutputFileImpl) abort() error {
+	if s.uploadID == "" {
+		return nil
+	}
+	resp, err := s.storage.do(http.MethodDelete, s.loc, url.Values{"uploadId": {s.uploadID}}, nil, nil)
+	s.uploadID = ""
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError(http.MethodDelete, s.loc, resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Router sends s3:// names to the object store and all other names to fallback,
+// usually the file storage.
+type Router struct {
+	s3       *StorageImpl
+	fallback mapReduceDomain.Storage
+}
+
+func NewRouter(s3 *StorageImpl, fallback mapReduceDomain.Storage) *Router {
+	return &Router{s3: s3, fallback: fallback}
+}
+
+func (r *Router) OpenInputFile(name string) (mapReduceDomain.InputFile, error) {
+	if IsURL(name) {
+		return r.s3.OpenInputFile(name)
+	}
+	return r.fallback.OpenInputFile(name)
+}
+
+func (r *Router) OpenInputFileAt(name string, offset int64) (mapReduceDomain.InputFile, error) {
+	if IsURL(name) {
+		return r.s3.OpenInputFileAt(name, offset)
+	}
+	rangeStorage, ok := r.fallback.(mapReduceDomain.RangeStorage)
+	if !ok {
+		return nil, fmt.Errorf("storage of %q can't open files at an offset", name)
+	}
+	return rangeStorage.OpenInputFileAt(name, offset)
+}
+
+func (r *Router) RemoveFile(name string) error {
+	if IsURL(name) {
+		return r.s3.RemoveFile(name)
+	}
+	removeStorage, ok := r.fallback.(mapReduceDomain.RemoveStorage)
+	if !ok {
+		return fmt.Errorf("storage of %q can't remove files", name)
+	}
+	return removeStorage.RemoveFile(name)
+}
+
+func (r *Router) InputVersion(name string) (mapReduceDomain.InputVersion, error) {
+	if IsURL(name) {
+		return r.s3.InputVersion(name)
+	}
+	versioner, ok := r.fallback.(mapReduceDomain.InputVersioner)
+	if !ok {
+		return mapReduceDomain.InputVersion{}, errors.ErrUnsupported
+	}
+	return versioner.InputVersion(name)
+}
+
+// FreeSpace is unsupported for s3:// names, an object store doesn't run out of space.
+func (r *Router) FreeSpace(name string) (int64, error) {
+	spaceStorage, ok := r.fallback.(mapReduceDomain.SpaceStorage)
+	if IsURL(name) || !ok {
+		return 0, errors.ErrUnsupported
+	}
+	return spaceStorage.FreeSpace(name)
+}
+
+func (r *Router) CreateOutputFile(name string) (mapReduceDomain.OutputFile, error) {
+	if IsURL(name) {
+		return r.s3.CreateOutputFile(name)
+	}
+	return r.fallback.CreateOutputFile(name)
+}
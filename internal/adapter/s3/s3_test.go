@@ -0,0 +1,291 @@
+package s3_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memoryAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/memory"
+	s3Adapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/s3"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// fakeS3 is the part of the S3 API the adapter uses: objects with ranged
+// GETs, single PUTs and multipart uploads.
+type fakeS3 struct {
+	mu            sync.Mutex
+	objects       map[string][]byte
+	uploads       map[string]map[int][]byte
+	nextUpload    int
+	failNextGets  int
+	ignoreRange   bool
+	gets          int
+	multipartUsed bool
+	unsigned      int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte)}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		f.unsigned++
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodHead:
+		data, ok := f.objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("ETag", fmt.Sprintf("\"%x\"", md5.Sum(data)))
+	case r.Method == http.MethodGet:
+		f.gets++
+		if f.failNextGets > 0 {
+			f.failNextGets--
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		data, ok := f.objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<Error><Code>NoSuchKey</Code><Message>no such key</Message></Error>")
+			return
+		}
+		var from, to int
+		_, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &from, &to)
+		if err != nil || f.ignoreRange {
+			w.Write(data)
+			return
+		}
+		if from >= len(data) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		to = min(to, len(data)-1)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", from, to, len(data)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[from : to+1])
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.nextUpload++
+		id := strconv.Itoa(f.nextUpload)
+		f.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		part, _ := strconv.Atoi(query.Get("partNumber"))
+		f.uploads[query.Get("uploadId")][part] = body
+		w.Header().Set("ETag", fmt.Sprintf("\"etag-%d\"", part))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		parts := f.uploads[query.Get("uploadId")]
+		numbers := make([]int, 0, len(parts))
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+		var data []byte
+		for _, n := range numbers {
+			data = append(data, parts[n]...)
+		}
+		f.objects[name] = data
+		delete(f.uploads, query.Get("uploadId"))
+		f.multipartUsed = true
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.objects[name] = body
+	case r.Method == http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+func newStorage(t *testing.T, fake *fakeS3) *s3Adapter.StorageImpl {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	storage, err := s3Adapter.NewStorage(s3Adapter.Config{
+		Endpoint:  server.URL,
+		AccessKey: "key",
+		SecretKey: "secret",
+		PartSize:  16,
+		ChunkSize: 7,
+	})
+	require.NoError(t, err)
+	return storage
+}
+
+func readLines(t *testing.T, storage mapreduce.Storage, name string) []string {
+	input, err := storage.OpenInputFile(name)
+	require.NoError(t, err)
+	defer input.Close()
+
+	var lines []string
+	for input.Scan() {
+		lines = append(lines, input.ReadLine())
+	}
+	require.NoError(t, input.Err())
+	return lines
+}
+
+func TestStorage_WriteRead(t *testing.T) {
+	fake := newFakeS3()
+	storage := newStorage(t, fake)
+
+	var want []string
+	out, err := storage.CreateOutputFile("s3://bucket/dir/big.tsv")
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		line := fmt.Sprintf("word%d\t%d", i, i)
+		want = append(want, line)
+		require.NoError(t, out.Write(line+"\n"))
+	}
+	require.NoError(t, out.Close())
+	assert.True(t, fake.multipartUsed)
+	assert.Empty(t, fake.uploads)
+
+	fake.failNextGets = 1
+	assert.Equal(t, want, readLines(t, storage, "s3://bucket/dir/big.tsv"))
+
+	out, err = storage.CreateOutputFile("s3://bucket/empty.tsv")
+	require.NoError(t, err)
+	require.NoError(t, out.Close())
+	assert.Empty(t, readLines(t, storage, "s3://bucket/empty.tsv"))
+
+	_, err = storage.OpenInputFile("s3://bucket/missing.tsv")
+	assert.ErrorContains(t, err, "NoSuchKey")
+	_, err = storage.OpenInputFile("bucket/missing.tsv")
+	assert.Error(t, err)
+	assert.Zero(t, fake.unsigned)
+}
+
+func TestStorage_Read_RangeIgnored(t *testing.T) {
+	fake := newFakeS3()
+	fake.ignoreRange = true
+	fake.objects["bucket/input.txt"] = []byte("first\nsecond\nthird\n")
+	storage := newStorage(t, fake)
+
+	// longer than a chunk, streamed from the single response
+	assert.Equal(t, []string{"first", "second", "third"}, readLines(t, storage, "s3://bucket/input.txt"))
+	assert.Equal(t, 1, fake.gets)
+
+	_, err := storage.OpenInputFileAt("s3://bucket/input.txt", 6)
+	assert.ErrorContains(t, err, "ignored the range")
+}
+
+func TestStorage_Read_RetriesExhausted(t *testing.T) {
+	fake := newFakeS3()
+	fake.objects["bucket/input.txt"] = []byte("a\n")
+	fake.failNextGets = 10
+	storage := newStorage(t, fake)
+
+	_, err := storage.OpenInputFile("s3://bucket/input.txt")
+	assert.ErrorContains(t, err, "status=503")
+	assert.Equal(t, s3Adapter.DefaultRetries, fake.gets, "a failed GET is retried by one loop")
+}
+
+func TestStorage_Read_ContextCancelled(t *testing.T) {
+	fake := newFakeS3()
+	fake.objects["bucket/input.txt"] = []byte("a\n")
+	fake.failNextGets = 10
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	// the backoff of 10 attempts would outlast the test
+	storage, err := s3Adapter.NewStorage(s3Adapter.Config{Endpoint: server.URL, AccessKey: "key", SecretKey: "secret", Retries: 10, Context: ctx})
+	require.NoError(t, err)
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err = storage.OpenInputFile("s3://bucket/input.txt")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorContains(t, err, "status=503")
+	assert.Equal(t, 1, fake.gets)
+}
+
+func TestStorage_InputVersion(t *testing.T) {
+	fake := newFakeS3()
+	fake.objects["bucket/input.txt"] = []byte("a\nb\n")
+	router := s3Adapter.NewRouter(newStorage(t, fake), memoryAdapter.NewStorage())
+
+	before, err := router.InputVersion("s3://bucket/input.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), before.Size)
+	assert.NotEmpty(t, before.ETag)
+
+	fake.objects["bucket/input.txt"] = []byte("a\nc\n")
+	after, err := router.InputVersion("s3://bucket/input.txt")
+	require.NoError(t, err)
+	assert.NotEqual(t, before, after)
+
+	_, err = router.InputVersion("s3://bucket/missing.txt")
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestService_DoTo_S3(t *testing.T) {
+	fake := newFakeS3()
+	fake.objects["bucket/input.txt"] = []byte("b\na\nc\nb\na\nb\n")
+	router := s3Adapter.NewRouter(newStorage(t, fake), memoryAdapter.NewStorage())
+	svc := mapreduce.NewService(2, 2, router, mapreduce.WithTempDir("s3://bucket/tmp/"))
+
+	out, err := router.CreateOutputFile("s3://bucket/output.tsv")
+	require.NoError(t, err)
+	w, err := mapreduce.NewResultWriter(out, mapreduce.FormatTSV, false)
+	require.NoError(t, err)
+	_, err = svc.DoTo(context.Background(), "s3://bucket/input.txt", mapreduce.SortByWord, w)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, "a\t2\nb\t3\nc\t1\n", string(fake.objects["bucket/output.tsv"]))
+	assert.Contains(t, fake.objects, "bucket/tmp/temp_0.tsv")
+}
+
+func TestRouter_RemoveFile(t *testing.T) {
+	fake := newFakeS3()
+	fake.objects["bucket/tmp/temp_0.tsv"] = []byte("a\t1\n")
+	local := memoryAdapter.NewStorage()
+	local.Put("temp_1.tsv", []byte("b\t1\n"))
+	router := s3Adapter.NewRouter(newStorage(t, fake), local)
+
+	require.NoError(t, router.RemoveFile("s3://bucket/tmp/temp_0.tsv"))
+	require.NoError(t, router.RemoveFile("temp_1.tsv"))
+	// removing what isn't there is fine
+	require.NoError(t, router.RemoveFile("s3://bucket/tmp/temp_0.tsv"))
+
+	assert.Empty(t, fake.objects)
+	assert.Empty(t, local.Names())
+}
@@ -0,0 +1,219 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	mapReduceDomain "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+const (
+	// DefaultHTTPRetries is how many attempts in total a request gets, the
+	// first one included.
+	DefaultHTTPRetries = 5
+	// DefaultHTTPBackoff is the delay before the first retry, it doubles every retry.
+	DefaultHTTPBackoff = 200 * time.Millisecond
+)
+
+// IsHTTPURL tells if the name is an http:// or https:// URL.
+func IsHTTPURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// HTTPSource streams inputs published on HTTP(S) servers. Failed requests are
+// retried with exponential backoff, and when the server supports ranges a
+// dropped connection is resumed with a Range request from the last byte read.
+type HTTPSource struct {
+	client  *http.Client
+	retries int
+	backoff time.Duration
+	ctx     context.Context
+}
+
+// HTTPOption configures optional behaviour of the HTTPSource.
+type HTTPOption func(*HTTPSource)
+
+// WithContext sends requests and waits between retries with ctx, cancelling
+// it stops both. Source has no ctx of its own, so it is given to the source
+// up front.
+func WithContext(ctx context.Context) HTTPOption {
+	return func(s *HTTPSource) {
+		s.ctx = ctx
+	}
+}
+
+// NewHTTPSource uses http.DefaultClient if client is nil. retries is how many
+// attempts in total a request gets, the first one included, and backoff the
+// delay before the second one; 0 takes the defaults.
+func NewHTTPSource(client *http.Client, retries int, backoff time.Duration, opts ...HTTPOption) *HTTPSource {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if retries <= 0 {
+		retries = DefaultHTTPRetries
+	}
+	if backoff <= 0 {
+		backoff = DefaultHTTPBackoff
+	}
+	s := &HTTPSource{client: client, retries: retries, backoff: backoff, ctx: context.Background()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *HTTPSource) OpenInputFile(name string) (mapReduceDomain.InputFile, error) {
+	return s.OpenInputFileAt(name, 0)
+}
+
+// OpenInputFileAt starts reading at the byte offset, it needs a server that
+// supports Range requests unless offset is 0.
+func (s *HTTPSource) OpenInputFileAt(name string, offset int64) (mapReduceDomain.InputFile, error) {
+	reader := &httpReader{source: s, url: name, offset: offset}
+	err := reader.open()
+	if err != nil {
+		return nil, fmt.Errorf("newInputFile filed, error=%w", err)
+	}
+
+	return NewInputFile(reader), nil
+}
+
+// InputVersion asks the server for the size, ETag and modification time of
+// the content with a HEAD request.
+func (s *HTTPSource) InputVersion(name string) (mapReduceDomain.InputVersion, error) {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodHead, name, nil)
+	if err != nil {
+		return mapReduceDomain.InputVersion{}, fmt.Errorf("create request failed, error=%w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return mapReduceDomain.InputVersion{}, fmt.Errorf("HEAD %s failed, error=%w", name, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return mapReduceDomain.InputVersion{}, fmt.Errorf("HEAD %s failed, status=%s", name, resp.Status)
+	}
+
+	version := mapReduceDomain.InputVersion{Size: resp.ContentLength, ETag: resp.Header.Get("ETag")}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		version.ModTime = modTime
+	}
+	return version, nil
+}
+
+// httpReader is the body of a GET that reconnects when it breaks.
+type httpReader struct {
+	source  *HTTPSource
+	url     string
+	offset  int64 // of the next byte to read
+	etag    string
+	ranges  bool
+	body    io.ReadCloser
+	retries int // left for the current stretch of failures
+}
+
+// open sends the GET for the rest of the content, retrying transient failures.
+func (r *httpReader) open() error {
+	var lastErr error
+	for attempt := 0; attempt < r.source.retries; attempt++ {
+		if attempt > 0 {
+			err := r.wait(r.source.backoff << (attempt - 1))
+			if err != nil {
+				return errors.Join(lastErr, err)
+			}
+		}
+
+		req, err := http.NewRequestWithContext(r.source.ctx, http.MethodGet, r.url, nil)
+		if err != nil {
+			return fmt.Errorf("create request failed, error=%w", err)
+		}
+		if r.offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+			if r.etag != "" {
+				// a changed file comes back whole with 200 and is rejected below
+				req.Header.Set("If-Range", r.etag)
+			}
+		}
+
+		resp, err := r.source.client.Do(req)
+		if err != nil {
+			if r.source.ctx.Err() != nil {
+				return fmt.Errorf("context cancelled, err if any=%w", r.source.ctx.Err())
+			}
+			lastErr = fmt.Errorf("GET %s failed, error=%w", r.url, err)
+			continue
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusPartialContent && r.offset > 0,
+			resp.StatusCode == http.StatusOK && r.offset == 0:
+			if r.etag == "" {
+				r.etag = resp.Header.Get("ETag")
+			}
+			r.ranges = r.ranges || resp.StatusCode == http.StatusPartialContent ||
+				resp.Header.Get("Accept-Ranges") == "bytes"
+			r.body = resp.Body
+			return nil
+		case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && r.offset > 0:
+			// nothing left after offset
+			resp.Body.Close()
+			r.body = http.NoBody
+			return nil
+		case resp.StatusCode == http.StatusOK:
+			resp.Body.Close()
+			return fmt.Errorf("GET %s can't continue from byte %d, the server ignored the range or the content changed", r.url, r.offset)
+		case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+			resp.Body.Close()
+			lastErr = fmt.Errorf("GET %s failed, status=%s", r.url, resp.Status)
+			continue
+		default:
+			resp.Body.Close()
+			return fmt.Errorf("GET %s failed, status=%s", r.url, resp.Status)
+		}
+	}
+
+	return lastErr
+}
+
+// wait sleeps before a retry unless the ctx of the source is cancelled first.
+func (r *httpReader) wait(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-r.source.ctx.Done():
+		return fmt.Errorf("context cancelled, err if any=%w", r.source.ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (r *httpReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == nil || errors.Is(err, io.EOF) {
+		if n > 0 {
+			r.retries = 0
+		}
+		return n, err
+	}
+	if !r.ranges || r.retries >= r.source.retries {
+		return n, fmt.Errorf("read %s failed at byte %d, error=%w", r.url, r.offset, err)
+	}
+
+	// connection dropped, continue where it broke
+	r.retries++
+	r.body.Close()
+	if openErr := r.open(); openErr != nil {
+		return n, fmt.Errorf("resume %s at byte %d failed, error=%w", r.url, r.offset, errors.Join(err, openErr))
+	}
+	return n, nil
+}
+
+func (r *httpReader) Close() error {
+	return r.body.Close()
+}
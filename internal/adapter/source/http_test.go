@@ -0,0 +1,179 @@
+package source_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sourceAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/source"
+	mapReduceDomain "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// httpServer serves requests with handle, it gets the number of the request
+// starting from 1 and returns the Range headers of all requests.
+func httpServer(t *testing.T, handle func(w http.ResponseWriter, r *http.Request, request int)) (url string, ranges func() []string) {
+	var mu sync.Mutex
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r.Header.Get("Range"))
+		request := len(got)
+		mu.Unlock()
+
+		handle(w, r, request)
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL + "/input.txt", func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), got...)
+	}
+}
+
+// dropAfter sends the first n bytes of the input and drops the connection.
+func dropAfter(w http.ResponseWriter, n int) {
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Length", strconv.Itoa(len(input)))
+	w.Write([]byte(input[:n]))
+	w.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func TestHTTPSource_Resume(t *testing.T) {
+	half := len(input) / 2
+	url, ranges := httpServer(t, func(w http.ResponseWriter, r *http.Request, request int) {
+		w.Header().Set("ETag", `"v1"`)
+		switch request {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			dropAfter(w, half)
+		default:
+			http.ServeContent(w, r, "input.txt", time.Time{}, strings.NewReader(input))
+		}
+	})
+
+	source := sourceAdapter.NewHTTPSource(nil, 3, time.Millisecond)
+	f, err := source.OpenInputFile(url)
+	require.NoError(t, err)
+	lines, err := readLines(t, f)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "a", "b", "c", "", "b"}, lines)
+	assert.Equal(t, []string{"", "", fmt.Sprintf("bytes=%d-", half)}, ranges())
+}
+
+func TestHTTPSource_RangeIgnored(t *testing.T) {
+	// the server answers every request with the whole content
+	whole := func(w http.ResponseWriter, r *http.Request, request int) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Write([]byte(input))
+	}
+
+	t.Run("open", func(t *testing.T) {
+		url, _ := httpServer(t, whole)
+		source := sourceAdapter.NewHTTPSource(nil, 3, time.Millisecond)
+		_, err := source.OpenInputFileAt(url, 4)
+		assert.ErrorContains(t, err, "can't continue from byte 4")
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		url, ranges := httpServer(t, func(w http.ResponseWriter, r *http.Request, request int) {
+			if request == 1 {
+				dropAfter(w, 4)
+			}
+			whole(w, r, request)
+		})
+		source := sourceAdapter.NewHTTPSource(nil, 3, time.Millisecond)
+		f, err := source.OpenInputFile(url)
+		require.NoError(t, err)
+		_, err = readLines(t, f)
+		assert.ErrorContains(t, err, "can't continue from byte 4")
+		assert.Equal(t, []string{"", "bytes=4-"}, ranges())
+	})
+}
+
+func TestHTTPSource_RangeNotSatisfiable(t *testing.T) {
+	url, ranges := httpServer(t, func(w http.ResponseWriter, r *http.Request, request int) {
+		http.ServeContent(w, r, "input.txt", time.Time{}, strings.NewReader(input))
+	})
+
+	source := sourceAdapter.NewHTTPSource(nil, 3, time.Millisecond)
+	f, err := source.OpenInputFileAt(url, int64(len(input)))
+	require.NoError(t, err)
+	lines, err := readLines(t, f)
+	require.NoError(t, err)
+	assert.Empty(t, lines)
+	assert.Equal(t, []string{fmt.Sprintf("bytes=%d-", len(input))}, ranges())
+}
+
+func TestHTTPSource_RetriesExhausted(t *testing.T) {
+	url, ranges := httpServer(t, func(w http.ResponseWriter, r *http.Request, request int) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	source := sourceAdapter.NewHTTPSource(nil, 3, time.Millisecond)
+	_, err := source.OpenInputFile(url)
+	assert.ErrorContains(t, err, "status=503")
+	assert.Len(t, ranges(), 3)
+
+	t.Run("resume", func(t *testing.T) {
+		url, ranges := httpServer(t, func(w http.ResponseWriter, r *http.Request, request int) {
+			if request == 1 {
+				dropAfter(w, 4)
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+		source := sourceAdapter.NewHTTPSource(nil, 2, time.Millisecond)
+		f, err := source.OpenInputFile(url)
+		require.NoError(t, err)
+		lines, err := readLines(t, f)
+		assert.ErrorContains(t, err, "status=503")
+		assert.Equal(t, []string{"b", "a"}, lines)
+		assert.Equal(t, []string{"", "bytes=4-", "bytes=4-"}, ranges())
+	})
+}
+
+func TestHTTPSource_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	url, ranges := httpServer(t, func(w http.ResponseWriter, r *http.Request, request int) {
+		// cancelled while open waits to retry, or while the reply is on its way
+		time.AfterFunc(10*time.Millisecond, cancel)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	// the backoff would outlast the test
+	source := sourceAdapter.NewHTTPSource(nil, 3, time.Hour, sourceAdapter.WithContext(ctx))
+	_, err := source.OpenInputFile(url)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, ranges(), 1)
+}
+
+func TestHTTPSource_InputVersion(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	url, _ := httpServer(t, func(w http.ResponseWriter, r *http.Request, request int) {
+		if request > 1 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "input.txt", modTime, strings.NewReader(input))
+	})
+
+	source := sourceAdapter.NewHTTPSource(nil, 3, time.Millisecond)
+	version, err := source.InputVersion(url)
+	require.NoError(t, err)
+	assert.Equal(t, mapReduceDomain.InputVersion{Size: int64(len(input)), ModTime: modTime, ETag: `"v1"`}, version)
+
+	_, err = source.InputVersion(url)
+	assert.ErrorContains(t, err, "404")
+}
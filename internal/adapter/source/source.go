@@ -0,0 +1,153 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"sync"
+
+	mapReduceDomain "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// FSSource reads inputs from any fs.FS: os.DirFS, embed.FS, zip.Reader, fstest.MapFS...
+// Names are slash separated paths as fs.FS expects them.
+type FSSource struct {
+	fsys fs.FS
+}
+
+func NewFSSource(fsys fs.FS) *FSSource {
+	return &FSSource{fsys: fsys}
+}
+
+func (s *FSSource) OpenInputFile(name string) (mapReduceDomain.InputFile, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("newInputFile filed, error=%w", err)
+	}
+
+	return NewInputFile(f), nil
+}
+
+// InputSize is the size of the file, for progress reports.
+func (s *FSSource) InputSize(name string) (int64, error) {
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// InputVersion is the size and modification time of the file.
+func (s *FSSource) InputVersion(name string) (mapReduceDomain.InputVersion, error) {
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return mapReduceDomain.InputVersion{}, err
+	}
+	return mapReduceDomain.InputVersion{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// ReaderSource serves a single io.Reader, whatever name is asked for. The
+// reader can only be opened once.
+type ReaderSource struct {
+	mu     sync.Mutex
+	reader io.Reader
+}
+
+func NewReaderSource(r io.Reader) *ReaderSource {
+	return &ReaderSource{reader: r}
+}
+
+func (s *ReaderSource) OpenInputFile(name string) (mapReduceDomain.InputFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reader == nil {
+		return nil, fmt.Errorf("newInputFile filed, error=reader for %q was already opened", name)
+	}
+	r := s.reader
+	s.reader = nil
+
+	return NewInputFile(r), nil
+}
+
+// InputFileImpl scans lines of any reader, it is the InputFile shared by all adapters.
+type InputFileImpl struct {
+	reader       io.Reader
+	inputScanner *bufio.Scanner
+}
+
+// NewInputFile wraps r, it is closed by Close if it is an io.Closer.
+func NewInputFile(r io.Reader) *InputFileImpl {
+	return &InputFileImpl{
+		reader:       r,
+		inputScanner: bufio.NewScanner(r),
+	}
+}
+
+func (s *InputFileImpl) Close() error {
+	if closer, ok := s.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (s *InputFileImpl) Scan() bool {
+	return s.inputScanner.Scan()
+}
+
+func (s *InputFileImpl) ReadLine() string {
+	return s.inputScanner.Text()
+}
+
+func (s *InputFileImpl) ReadMappedLine() (string, int64, error) {
+	return ParseMappedLine(s.ReadLine())
+}
+
+// ParseMappedLine splits an intermediate "word\tcount" line. The count is
+// after the last tab, so words containing tabs survive intermediates.
+func ParseMappedLine(line string) (string, int64, error) {
+	i := strings.LastIndexByte(line, '\t')
+	if i < 0 {
+		return "", 0, fmt.Errorf("line should be word and count separated by tab, got %q", line)
+	}
+	word := line[:i]
+	count, err := strconv.ParseInt(line[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("second part in line should be integer, but was not. Error=%w", err)
+	}
+
+	return word, count, nil
+}
+
+func (s *InputFileImpl) ReadRecord() ([]byte, int64, error) {
+	return ParseRecord(s.inputScanner.Bytes())
+}
+
+// ParseRecord is ParseMappedLine for byte lines, the key is a slice of line.
+func ParseRecord(line []byte) ([]byte, int64, error) {
+	i := bytes.LastIndexByte(line, '\t')
+	if i < 0 {
+		return nil, 0, fmt.Errorf("line should be word and count separated by tab, got %q", line)
+	}
+	count, err := strconv.ParseInt(string(line[i+1:]), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("second part in line should be integer, but was not. Error=%w", err)
+	}
+
+	return line[:i], count, nil
+}
+
+// AppendRecord appends the "key\tcount\n" line OutputFile.WriteRecord writes.
+func AppendRecord(dst []byte, key []byte, count int64) []byte {
+	dst = append(dst, key...)
+	dst = append(dst, '\t')
+	dst = strconv.AppendInt(dst, count, 10)
+	return append(dst, '\n')
+}
+
+func (s *InputFileImpl) Err() error {
+	return s.inputScanner.Err()
+}
@@ -0,0 +1,104 @@
+package source_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	sourceAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/source"
+	mapReduceDomain "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+const input = "b\na\nb\nc\n\nb\n"
+
+// readLines reads all lines of the input and closes it.
+func readLines(t *testing.T, input mapReduceDomain.InputFile) ([]string, error) {
+	t.Helper()
+	var lines []string
+	for input.Scan() {
+		lines = append(lines, input.ReadLine())
+	}
+	err := input.Err()
+	require.NoError(t, input.Close())
+	return lines, err
+}
+
+func TestFSSource(t *testing.T) {
+	source := sourceAdapter.NewFSSource(fstest.MapFS{"data/input.txt": {Data: []byte(input)}})
+
+	f, err := source.OpenInputFile("data/input.txt")
+	require.NoError(t, err)
+	lines, err := readLines(t, f)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "a", "b", "c", "", "b"}, lines)
+
+	size, err := source.InputSize("data/input.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(input)), size)
+
+	_, err = source.OpenInputFile("input.txt")
+	assert.Error(t, err)
+	_, err = source.InputSize("input.txt")
+	assert.Error(t, err)
+}
+
+func TestReaderSource(t *testing.T) {
+	source := sourceAdapter.NewReaderSource(strings.NewReader(input))
+
+	f, err := source.OpenInputFile("-")
+	require.NoError(t, err)
+	lines, err := readLines(t, f)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "a", "b", "c", "", "b"}, lines)
+
+	_, err = source.OpenInputFile("-")
+	assert.ErrorContains(t, err, "already opened")
+}
+
+// failingReader returns data and then err.
+type failingReader struct {
+	data string
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestReaderSource_ReadFails(t *testing.T) {
+	source := sourceAdapter.NewReaderSource(&failingReader{data: "a\nb\n", err: errors.New("connection reset")})
+
+	f, err := source.OpenInputFile("-")
+	require.NoError(t, err)
+	lines, err := readLines(t, f)
+	assert.ErrorContains(t, err, "connection reset")
+	assert.Equal(t, []string{"a", "b"}, lines)
+}
+
+func TestParseMappedLine(t *testing.T) {
+	word, count, err := sourceAdapter.ParseMappedLine("a\tb\t12")
+	require.NoError(t, err)
+	assert.Equal(t, "a\tb", word)
+	assert.Equal(t, int64(12), count)
+
+	line := sourceAdapter.AppendRecord(nil, []byte("a\tb"), 12)
+	assert.Equal(t, "a\tb\t12\n", string(line))
+	key, count, err := sourceAdapter.ParseRecord(line[:len(line)-1])
+	require.NoError(t, err)
+	assert.Equal(t, "a\tb", string(key))
+	assert.Equal(t, int64(12), count)
+
+	_, _, err = sourceAdapter.ParseMappedLine("a")
+	assert.Error(t, err)
+	_, _, err = sourceAdapter.ParseRecord([]byte("a\tx"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,120 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	mapReduceDomain "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// SpanRecord is a finished span as the JSONTracer writes it. The fields follow
+// OpenTelemetry, so the records can be converted for a collector.
+type SpanRecord struct {
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Name       string         `json:"name"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	Duration   time.Duration  `json:"duration_ns"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// JSONTracer writes every finished span as a line of JSON, children before
+// their parents. It is safe for concurrent use.
+type JSONTracer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{enc: json.NewEncoder(w)}
+}
+
+type spanKey struct{}
+
+type span struct {
+	tracer *JSONTracer
+	record SpanRecord
+}
+
+// Start starts a span, a child of the span in ctx if there is one.
+func (t *JSONTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, mapReduceDomain.Span) {
+	s := &span{
+		tracer: t,
+		record: SpanRecord{
+			SpanID: newID(8),
+			Name:   name,
+			Start:  time.Now(),
+		},
+	}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.record.TraceID = parent.record.TraceID
+		s.record.ParentID = parent.record.SpanID
+	} else {
+		s.record.TraceID = newID(16)
+	}
+	s.SetAttributes(attrs...)
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Err is the first error writing a span, spans after it are dropped.
+func (t *JSONTracer) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.err
+}
+
+func (t *JSONTracer) export(record SpanRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err != nil {
+		return
+	}
+	err := t.enc.Encode(record)
+	if err != nil {
+		t.err = fmt.Errorf("write span failed, error=%w", err)
+	}
+}
+
+func (s *span) SetAttributes(attrs ...slog.Attr) {
+	if len(attrs) == 0 {
+		return
+	}
+	if s.record.Attributes == nil {
+		s.record.Attributes = make(map[string]any, len(attrs))
+	}
+	for _, attr := range attrs {
+		s.record.Attributes[attr.Key] = attr.Value.Resolve().Any()
+	}
+}
+
+func (s *span) End(err error) {
+	s.record.End = time.Now()
+	s.record.Duration = s.record.End.Sub(s.record.Start)
+	if err != nil {
+		s.record.Error = err.Error()
+	}
+	s.tracer.export(s.record)
+}
+
+// newID is a random hex id of n bytes, ids of OpenTelemetry spans are 8 bytes
+// and of traces 16.
+func newID(n int) string {
+	b := make([]byte, n)
+	// never fails, see the docs of crypto/rand.Read
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,100 @@
+package trace_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memoryAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/memory"
+	traceAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/trace"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+func decodeSpans(t *testing.T, buf *bytes.Buffer) []traceAdapter.SpanRecord {
+	var spans []traceAdapter.SpanRecord
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		var span traceAdapter.SpanRecord
+		require.NoError(t, decoder.Decode(&span))
+		spans = append(spans, span)
+	}
+
+	return spans
+}
+
+func TestJSONTracer_Do(t *testing.T) {
+	storage := memoryAdapter.NewStorage()
+	storage.Put("input.txt", []byte("b\na\nb\nc\n\nb\nd\na\n"))
+	var buf bytes.Buffer
+	tracer := traceAdapter.NewJSONTracer(&buf)
+	svc := mapreduce.NewService(2, 1, storage, mapreduce.WithTracer(tracer))
+
+	_, _, err := svc.Do(context.Background(), "input.txt")
+	require.NoError(t, err)
+	require.NoError(t, tracer.Err())
+
+	spans := decodeSpans(t, &buf)
+	byID := make(map[string]traceAdapter.SpanRecord)
+	children := make(map[string][]string) // names of the children of a span name
+	for _, span := range spans {
+		byID[span.SpanID] = span
+	}
+	for _, span := range spans {
+		assert.Equal(t, spans[len(spans)-1].TraceID, span.TraceID)
+		assert.Empty(t, span.Error)
+		if span.ParentID != "" {
+			parent, ok := byID[span.ParentID]
+			require.True(t, ok, "parent of %s not exported", span.Name)
+			assert.False(t, span.Start.Before(parent.Start))
+			assert.False(t, span.End.After(parent.End))
+			children[parent.Name] = append(children[parent.Name], span.Name)
+		}
+	}
+
+	// the root is exported last, after all of its children
+	root := spans[len(spans)-1]
+	assert.Equal(t, "do", root.Name)
+	assert.Empty(t, root.ParentID)
+	assert.Equal(t, "input.txt", root.Attributes["input"])
+	// 4 spills of 2 unique words, then 4 -> 2 -> 1 files
+	assert.Equal(t, []string{"map", "reduce round", "reduce round"}, children["do"])
+	assert.Equal(t, []string{"spill", "spill", "spill", "spill"}, children["map"])
+	assert.Equal(t, []string{"merge", "merge", "merge"}, children["reduce round"])
+
+	for _, span := range spans {
+		switch span.Name {
+		case "map":
+			assert.EqualValues(t, 8, span.Attributes["lines"])
+			assert.EqualValues(t, 15, span.Attributes["bytes"])
+			assert.EqualValues(t, 4, span.Attributes["spills"])
+		case "spill":
+			assert.Contains(t, span.Attributes, "file")
+			assert.Contains(t, span.Attributes, "keys")
+			assert.Contains(t, span.Attributes, "bytes")
+		case "merge":
+			assert.Len(t, span.Attributes["inputs"], 2)
+			assert.Contains(t, span.Attributes, "output")
+			assert.Contains(t, span.Attributes, "records")
+		}
+	}
+}
+
+func TestJSONTracer_Error(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := traceAdapter.NewJSONTracer(&buf)
+	svc := mapreduce.NewService(2, 1, memoryAdapter.NewStorage(), mapreduce.WithTracer(tracer))
+
+	_, _, err := svc.Do(context.Background(), "missing.txt")
+	require.Error(t, err)
+
+	spans := decodeSpans(t, &buf)
+	require.Len(t, spans, 2)
+	assert.Equal(t, "map", spans[0].Name)
+	assert.NotEmpty(t, spans[0].Error)
+	assert.Equal(t, "do", spans[1].Name)
+	assert.Equal(t, err.Error(), spans[1].Error)
+}
@@ -0,0 +1,304 @@
+package mapreduce
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RemoveStorage is a Storage that can also delete files, a job that fails or
+// is cancelled removes its intermediate files from it. It is not an error to
+// remove a file that doesn't exist.
+type RemoveStorage interface {
+	Storage
+	RemoveFile(name string) error
+}
+
+// InputVersion tells the content of an input apart from what was at the same
+// name before, by the fields the source knows. Local files have a size and a
+// modification time, objects have an ETag.
+type InputVersion struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	ETag    string    `json:"etag,omitempty"`
+}
+
+// InputVersioner is implemented by sources that know the version of an
+// input, a manifest only resumes the version of the input it was written for.
+type InputVersioner interface {
+	InputVersion(name string) (InputVersion, error)
+}
+
+// WithManifest keeps the intermediate files of a Do or DoTo job that fails or
+// is cancelled after its map phase, and writes the list of them to the
+// manifest file of the given name in the storage. The next job of the same
+// input resumes from them instead of reading the input again, and removes
+// the manifest once it is done. If the source is an InputVersioner, a
+// manifest of an input that changed since is ignored.
+func WithManifest(name string) Option {
+	return func(s *Service) {
+		s.manifest = name
+	}
+}
+
+// manifest is the content of the manifest file.
+type manifest struct {
+	Input string `json:"input"`
+	// Version of the input, nil if the source doesn't know it.
+	Version *InputVersion `json:"version,omitempty"`
+	// Files are sorted by word and hold all counts of the input together.
+	Files []string `json:"files"`
+}
+
+type filesKey struct{}
+
+// jobFiles tracks the intermediate files of the job whose ctx carries it, a
+// nil jobFiles tracks nothing.
+type jobFiles struct {
+	mu      sync.Mutex
+	created []string
+	// input of a job that can be resumed, empty for other jobs
+	input string
+	// version of the input when the job started, nil if it isn't known
+	version *InputVersion
+	// pending are the latest files holding all counts, nil until the map
+	// phase is done
+	pending []string
+	resumed bool
+}
+
+func withJobFiles(ctx context.Context) (context.Context, *jobFiles) {
+	files := &jobFiles{}
+	return context.WithValue(ctx, filesKey{}, files), files
+}
+
+func filesFrom(ctx context.Context) *jobFiles {
+	files, _ := ctx.Value(filesKey{}).(*jobFiles)
+	return files
+}
+
+// resumable marks the job as one that a manifest can resume.
+func (f *jobFiles) resumable(input string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.input = input
+}
+
+func (f *jobFiles) add(name string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.created = append(f.created, name)
+}
+
+// sorted records files sorted by word that hold all counts of the input.
+func (f *jobFiles) sorted(files []string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.pending = slices.Clone(files)
+}
+
+// createIntermediate creates an intermediate file of the job, it is removed
+// if the job fails.
+func (s *Service) createIntermediate(ctx context.Context, name string) (OutputFile, error) {
+	filesFrom(ctx).add(name)
+	return s.storage.CreateOutputFile(name)
+}
+
+// mapOrResume is mapAndShuffle of a job that resumes from the files of its
+// manifest if there is one.
+func (s *Service) mapOrResume(ctx context.Context, inputs Inputs, keepInMemory bool) (tempFiles []string, kept map[string]int64, err error) {
+	files := filesFrom(ctx)
+	if s.manifest != "" && files != nil && files.input != "" {
+		version := s.inputVersion(ctx, files.input)
+		files.mu.Lock()
+		files.version = version
+		files.mu.Unlock()
+
+		m, ok := s.readManifest()
+		switch {
+		case !ok || m.Input != files.input || len(m.Files) == 0:
+			// nothing to resume
+		case !sameVersion(m.Version, version):
+			s.logger.WarnContext(ctx, "manifest ignored, the input changed since it was written", "manifest", s.manifest,
+				"input", files.input, "manifest_version", m.Version, "input_version", version)
+			s.removeManifest(ctx, m)
+		default:
+			s.logger.InfoContext(ctx, "job resumed", "manifest", s.manifest, "files", m.Files)
+			files.mu.Lock()
+			files.resumed = true
+			files.mu.Unlock()
+			files.sorted(m.Files)
+			// nothing is mapped, the reduce phase starts right away
+			statsFrom(ctx).mapDone(0, 0, 0)
+			return m.Files, nil, nil
+		}
+	}
+
+	tempFiles, kept, err = s.mapAndShuffle(ctx, inputs, keepInMemory)
+	if err != nil {
+		return nil, nil, err
+	}
+	files.sorted(tempFiles)
+
+	return tempFiles, kept, nil
+}
+
+// inputVersion is the version of the input if the source knows it.
+func (s *Service) inputVersion(ctx context.Context, name string) *InputVersion {
+	versioner, ok := s.source.(InputVersioner)
+	if !ok {
+		return nil
+	}
+	version, err := versioner.InputVersion(name)
+	if err != nil {
+		s.logger.WarnContext(ctx, "input version unknown", "input", name, "error", err)
+		return nil
+	}
+	return &version
+}
+
+// sameVersion tells if two versions are of the same input content, unknown
+// versions are only the same as each other.
+func sameVersion(a, b *InputVersion) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Size == b.Size && a.ModTime.Equal(b.ModTime) && a.ETag == b.ETag
+}
+
+// removeManifest removes an ignored manifest and the files it lists, so they
+// are neither resumed nor left behind. A file that can't be removed is only
+// logged, the job doesn't need it.
+func (s *Service) removeManifest(ctx context.Context, m manifest) {
+	remover, ok := s.storage.(RemoveStorage)
+	if !ok {
+		return
+	}
+	for _, name := range append(m.Files, s.manifest) {
+		err := remover.RemoveFile(name)
+		if err != nil {
+			s.logger.WarnContext(ctx, "remove file of ignored manifest failed", "file", name, "error", err)
+		}
+	}
+}
+
+// readManifest reads the manifest, ok is false if there is none or it can't
+// be read.
+func (s *Service) readManifest() (m manifest, ok bool) {
+	file, err := s.storage.OpenInputFile(s.manifest)
+	if err != nil {
+		return manifest{}, false
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			s.logger.Warn("close manifest failed", "manifest", s.manifest, "error", err)
+		}
+	}()
+	var data strings.Builder
+	for file.Scan() {
+		data.WriteString(file.ReadLine())
+		data.WriteByte('\n')
+	}
+	if err := file.Err(); err != nil {
+		s.logger.Warn("read manifest failed", "manifest", s.manifest, "error", err)
+		return manifest{}, false
+	}
+	if strings.TrimSpace(data.String()) == "" {
+		return manifest{}, false
+	}
+	err = json.NewDecoder(strings.NewReader(data.String())).Decode(&m)
+	if err != nil {
+		s.logger.Warn("manifest ignored", "manifest", s.manifest, "error", err)
+		return manifest{}, false
+	}
+
+	return m, true
+}
+
+// writeManifest writes the manifest with a file per line, a job with
+// thousands of files doesn't make a line too long to read back.
+func (s *Service) writeManifest(m manifest) (err error) {
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return fmt.Errorf("marshal manifest failed, error=%w", err)
+	}
+	writer, err := s.storage.CreateOutputFile(s.manifest)
+	if err != nil {
+		return fmt.Errorf("create manifest failed, error=%w", err)
+	}
+	defer func() {
+		if closeErr := writer.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("close manifest failed, err=%w", closeErr))
+		}
+	}()
+
+	return writer.Write(string(data) + "\n")
+}
+
+// finishFiles cleans up after a job: a failed job removes its intermediate
+// files, or keeps the sorted ones and writes a manifest to resume from them.
+// A resumed job that succeeded removes the manifest.
+func (s *Service) finishFiles(ctx context.Context, files *jobFiles, jobErr error) error {
+	files.mu.Lock()
+	defer files.mu.Unlock()
+
+	remover, ok := s.storage.(RemoveStorage)
+	if jobErr == nil {
+		if !files.resumed || !ok {
+			return nil
+		}
+		err := remover.RemoveFile(s.manifest)
+		if err != nil {
+			return fmt.Errorf("remove manifest failed, error=%w", err)
+		}
+		s.logger.InfoContext(ctx, "manifest removed", "manifest", s.manifest)
+		return nil
+	}
+
+	var keep []string
+	var err error
+	if s.manifest != "" && files.input != "" && files.pending != nil {
+		err = s.writeManifest(manifest{Input: files.input, Version: files.version, Files: files.pending})
+		if err == nil {
+			keep = files.pending
+			s.logger.InfoContext(ctx, "manifest written", "manifest", s.manifest, "files", files.pending)
+		}
+	}
+	if !ok {
+		return err
+	}
+
+	removed := 0
+	for _, name := range files.created {
+		if slices.Contains(keep, name) {
+			continue
+		}
+		removeErr := remover.RemoveFile(name)
+		if removeErr != nil {
+			err = errors.Join(err, fmt.Errorf("remove intermediate file failed, error=%w", removeErr))
+			continue
+		}
+		s.logger.DebugContext(ctx, "intermediate removed", "file", name)
+		removed++
+	}
+	s.logger.InfoContext(ctx, "intermediates cleaned up", "removed", removed, "kept", len(keep))
+
+	return err
+}
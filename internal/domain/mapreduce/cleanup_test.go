@@ -0,0 +1,289 @@
+package mapreduce_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memoryAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/memory"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// failingStorage fails to create the file named failName, to close the file
+// named failClose and to open the file named failOpen.
+type failingStorage struct {
+	*memoryAdapter.StorageImpl
+	failName  string
+	failClose string
+	failOpen  string
+}
+
+func (s *failingStorage) CreateOutputFile(name string) (mapreduce.OutputFile, error) {
+	if name == s.failName {
+		return nil, errors.New("disk full")
+	}
+	out, err := s.StorageImpl.CreateOutputFile(name)
+	if err != nil || name != s.failClose {
+		return out, err
+	}
+	return failingCloseOutput{}, nil
+}
+
+func (s *failingStorage) OpenInputFile(name string) (mapreduce.InputFile, error) {
+	if name == s.failOpen {
+		return nil, errors.New("input is gone")
+	}
+	input, err := s.StorageImpl.OpenInputFile(name)
+	if err != nil || name != s.failClose {
+		return input, err
+	}
+	return failingCloseInput{InputFile: input}, nil
+}
+
+// failingCloseOutput loses what is written to it, like a file whose buffered
+// writes can't be flushed, and only reports it on Close.
+type failingCloseOutput struct{}
+
+func (failingCloseOutput) Write(string) error              { return nil }
+func (failingCloseOutput) WriteRecord([]byte, int64) error { return nil }
+func (failingCloseOutput) Close() error                    { return errors.New("flush failed: disk full") }
+
+type failingCloseInput struct {
+	mapreduce.InputFile
+}
+
+func (f failingCloseInput) Close() error {
+	return errors.Join(f.InputFile.Close(), errors.New("close failed: stale file handle"))
+}
+
+// 4 spills of 2 unique words, merged into merged_0 and merged_1, then merged_2
+const cleanupInput = "b\na\nb\nc\n\nb\nd\na\n"
+
+func TestService_Do_RemovesIntermediatesOnFailure(t *testing.T) {
+	storage := &failingStorage{StorageImpl: memoryAdapter.NewStorage(), failName: "merged_2.tsv"}
+	storage.Put("input.txt", []byte(cleanupInput))
+	svc := mapreduce.NewService(2, 1, storage)
+
+	_, _, err := svc.Do(context.Background(), "input.txt")
+	require.ErrorContains(t, err, "disk full")
+
+	assert.Equal(t, []string{"input.txt"}, storage.Names())
+}
+
+func TestService_DoTo_CancelledMerge(t *testing.T) {
+	storage := memoryAdapter.NewStorage()
+	storage.Put("input.txt", []byte(cleanupInput))
+	svc := mapreduce.NewService(2, 1, storage)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the last merge streams into the writer, cancel it after the first row
+	w := &cancellingWriter{cancel: cancel}
+	_, err := svc.DoTo(ctx, "input.txt", mapreduce.SortByWord, w)
+	require.ErrorIs(t, err, context.Canceled)
+
+	assert.Equal(t, 1, w.rows)
+	assert.Equal(t, []string{"input.txt"}, storage.Names())
+}
+
+type cancellingWriter struct {
+	cancel context.CancelFunc
+	rows   int
+}
+
+func (w *cancellingWriter) Write(string, int64) error {
+	w.rows++
+	w.cancel()
+	return nil
+}
+
+func (w *cancellingWriter) Close() error {
+	return nil
+}
+
+// cancellingStorage cancels the job when the file named cancelAt is created,
+// the merge creating it goes on a bit longer than the job would.
+type cancellingStorage struct {
+	*memoryAdapter.StorageImpl
+	cancelAt string
+	cancel   context.CancelFunc
+}
+
+func (s *cancellingStorage) CreateOutputFile(name string) (mapreduce.OutputFile, error) {
+	if name == s.cancelAt {
+		s.cancel()
+		time.Sleep(50 * time.Millisecond)
+	}
+	return s.StorageImpl.CreateOutputFile(name)
+}
+
+func TestService_Do_CancelledMergeRound(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storage := &cancellingStorage{StorageImpl: memoryAdapter.NewStorage(), cancelAt: "merged_0.tsv", cancel: cancel}
+	// 4096 spills, the job is cancelled while the first round starts merges
+	var input strings.Builder
+	for i := 0; i < 8192; i++ {
+		fmt.Fprintf(&input, "w%d\n", i)
+	}
+	storage.Put("input.txt", []byte(input.String()))
+	svc := mapreduce.NewService(2, 1, storage)
+
+	_, _, err := svc.Do(ctx, "input.txt")
+	require.ErrorIs(t, err, context.Canceled)
+
+	// a merge still running would create its file after the cleanup
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, []string{"input.txt"}, storage.Names())
+}
+
+func TestService_Do_ResumeFromManifest(t *testing.T) {
+	storage := &failingStorage{StorageImpl: memoryAdapter.NewStorage(), failName: "merged_2.tsv"}
+	storage.Put("input.txt", []byte(cleanupInput))
+	svc := mapreduce.NewService(2, 1, storage, mapreduce.WithManifest("job.manifest"))
+
+	_, _, err := svc.Do(context.Background(), "input.txt")
+	require.Error(t, err)
+
+	// the spills are merged already, only the merged files are kept
+	assert.Equal(t, []string{"input.txt", "job.manifest", "merged_0.tsv", "merged_1.tsv"}, storage.Names())
+	data, _ := storage.Get("job.manifest")
+	var manifest struct {
+		Input string
+		Files []string
+	}
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	assert.Equal(t, "input.txt", manifest.Input)
+	// the merges of a round finish in any order
+	assert.ElementsMatch(t, []string{"merged_0.tsv", "merged_1.tsv"}, manifest.Files)
+
+	// the resumed job doesn't read the input again
+	storage.failOpen = "input.txt"
+	storage.failName = ""
+	result, stats, err := svc.Do(context.Background(), "input.txt")
+	require.NoError(t, err)
+
+	data, _ = storage.Get(result)
+	assert.Equal(t, "a\t2\nb\t3\nc\t1\nd\t1\n", string(data))
+	assert.Zero(t, stats.Tokens)
+	assert.Equal(t, 1, stats.MergePasses)
+	_, ok := storage.Get("job.manifest")
+	assert.False(t, ok)
+	for _, name := range storage.Names() {
+		assert.True(t, name == "input.txt" || strings.HasPrefix(name, "merged_"), name)
+	}
+}
+
+func TestService_Do_ResumeFromLongManifest(t *testing.T) {
+	// 8192 spills merged into 4096 files, the next round fails
+	storage := &failingStorage{StorageImpl: memoryAdapter.NewStorage(), failName: "merged_4096.tsv"}
+	var input, want strings.Builder
+	for i := 0; i < 16384; i++ {
+		fmt.Fprintf(&input, "w%05d\n", i)
+		fmt.Fprintf(&want, "w%05d\t1\n", i)
+	}
+	storage.Put("input.txt", []byte(input.String()))
+	svc := mapreduce.NewService(2, 4, storage, mapreduce.WithManifest("job.manifest"))
+
+	_, _, err := svc.Do(context.Background(), "input.txt")
+	require.ErrorContains(t, err, "disk full")
+	data, _ := storage.Get("job.manifest")
+	assert.Greater(t, len(data), bufio.MaxScanTokenSize)
+
+	storage.failOpen = "input.txt"
+	storage.failName = ""
+	result, stats, err := svc.Do(context.Background(), "input.txt")
+	require.NoError(t, err)
+
+	data, _ = storage.Get(result)
+	assert.Equal(t, want.String(), string(data))
+	assert.Zero(t, stats.Tokens, "the job is resumed")
+	_, ok := storage.Get("job.manifest")
+	assert.False(t, ok)
+}
+
+func TestService_Do_ManifestOfOtherInput(t *testing.T) {
+	storage := memoryAdapter.NewStorage()
+	storage.Put("input.txt", []byte(cleanupInput))
+	storage.Put("job.manifest", []byte(`{"input":"other.txt","files":["missing.tsv"]}`+"\n"))
+	svc := mapreduce.NewService(2, 1, storage, mapreduce.WithManifest("job.manifest"))
+
+	result, _, err := svc.Do(context.Background(), "input.txt")
+	require.NoError(t, err)
+
+	data, _ := storage.Get(result)
+	assert.Equal(t, "a\t2\nb\t3\nc\t1\nd\t1\n", string(data))
+	_, ok := storage.Get("job.manifest")
+	assert.True(t, ok, "the manifest of another input is left alone")
+}
+
+func TestService_Do_ManifestOfChangedInput(t *testing.T) {
+	storage := &failingStorage{StorageImpl: memoryAdapter.NewStorage(), failName: "merged_2.tsv"}
+	storage.Put("input.txt", []byte(cleanupInput))
+	svc := mapreduce.NewService(2, 1, storage, mapreduce.WithManifest("job.manifest"))
+
+	_, _, err := svc.Do(context.Background(), "input.txt")
+	require.Error(t, err)
+	data, _ := storage.Get("job.manifest")
+	var manifest struct {
+		Version mapreduce.InputVersion
+	}
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	assert.Equal(t, int64(len(cleanupInput)), manifest.Version.Size)
+
+	// rewritten with the same size, the kept files count the old words
+	storage.Put("input.txt", []byte(strings.ReplaceAll(cleanupInput, "b", "e")))
+	storage.failName = ""
+	result, stats, err := svc.Do(context.Background(), "input.txt")
+	require.NoError(t, err)
+
+	data, _ = storage.Get(result)
+	assert.Equal(t, "a\t2\nc\t1\nd\t1\ne\t3\n", string(data))
+	assert.Equal(t, int64(7), stats.Tokens, "the input is read again")
+	_, ok := storage.Get("job.manifest")
+	assert.False(t, ok, "the ignored manifest is removed")
+}
+
+func TestService_Do_CloseFails(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{name: "input", file: "input.txt", wantErr: "stale file handle"},
+		{name: "spill", file: "temp_1.tsv", wantErr: "disk full"},
+		{name: "merge", file: "merged_1.tsv", wantErr: "disk full"},
+		{name: "result", file: "merged_2.tsv", wantErr: "disk full"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &failingStorage{StorageImpl: memoryAdapter.NewStorage(), failClose: tt.file}
+			storage.Put("input.txt", []byte(cleanupInput))
+			svc := mapreduce.NewService(2, 1, storage)
+
+			_, _, err := svc.Do(context.Background(), "input.txt")
+			require.ErrorContains(t, err, tt.wantErr)
+
+			assert.Equal(t, []string{"input.txt"}, storage.Names())
+		})
+	}
+}
+
+func TestService_DoTo_CloseFails(t *testing.T) {
+	storage := &failingStorage{StorageImpl: memoryAdapter.NewStorage(), failClose: "merged_0.tsv"}
+	storage.Put("input.txt", []byte(cleanupInput))
+	svc := mapreduce.NewService(2, 1, storage)
+
+	_, err := svc.DoTo(context.Background(), "input.txt", mapreduce.SortByWord, &cancellingWriter{cancel: func() {}})
+	require.ErrorContains(t, err, "disk full")
+	assert.Equal(t, []string{"input.txt"}, storage.Names())
+}
@@ -0,0 +1,28 @@
+package mapreduce
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrCountOverflow is returned when a sum of counts doesn't fit in int64,
+// unless the Service is created WithSaturatingCounts.
+var ErrCountOverflow = errors.New("count overflow")
+
+// addCounts is a + b checked for overflow, what is the name of the summed count
+// for the error.
+func (s *Service) addCounts(what string, a, b int64) (int64, error) {
+	sum := a + b
+	// a sum overflows only if both terms have the same sign and the sum has not
+	if (a >= 0) != (b >= 0) || (sum >= 0) == (a >= 0) {
+		return sum, nil
+	}
+	if !s.saturateCounts {
+		return 0, fmt.Errorf("%w: %d + %d for %q", ErrCountOverflow, a, b, what)
+	}
+	if a >= 0 {
+		return math.MaxInt64, nil
+	}
+	return math.MinInt64, nil
+}
@@ -0,0 +1,38 @@
+package mapreduce_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	memoryAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/memory"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+func TestService_Update_CountOverflow(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []mapreduce.Option
+		want    []mapreduce.WordCount
+		wantErr error
+	}{
+		{"error", nil, nil, mapreduce.ErrCountOverflow},
+		{"saturate", []mapreduce.Option{mapreduce.WithSaturatingCounts()}, []mapreduce.WordCount{{"a", math.MaxInt64}, {"b", 1}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := memoryAdapter.NewStorage()
+			storage.Put("output.tsv", []byte("a\t9223372036854775806\n"))
+			storage.Put("input.txt", []byte("a\na\nb\n"))
+			svc := mapreduce.NewService(10, 1, storage, tt.opts...)
+
+			w := &rowsWriter{}
+			err := svc.Update(context.Background(), "output.tsv", "input.txt", false, w)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, w.rows)
+		})
+	}
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+package mapreduce
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime is the user and system CPU time the process used so far.
+func processCPUTime() time.Duration {
+	var usage syscall.Rusage
+	err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
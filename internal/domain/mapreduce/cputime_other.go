@@ -0,0 +1,10 @@
+//go:build !linux
+
+package mapreduce
+
+import "time"
+
+// processCPUTime is 0, the CPU time of the process isn't read on this platform.
+func processCPUTime() time.Duration {
+	return 0
+}
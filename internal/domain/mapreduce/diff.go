@@ -0,0 +1,245 @@
+package mapreduce
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+)
+
+// DiffKind tells how a word changed between two results.
+type DiffKind int
+
+const (
+	DiffAdded DiffKind = iota
+	DiffRemoved
+	DiffChanged
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffChanged:
+		return "changed"
+	default:
+		return fmt.Sprintf("DiffKind(%d)", int(k))
+	}
+}
+
+// WordDiff is a word whose count differs between the old and the new result.
+// Relative is Delta divided by the old count, +Inf for added words.
+type WordDiff struct {
+	Word     string
+	Kind     DiffKind
+	Old      int64
+	New      int64
+	Delta    int64
+	Relative float64
+}
+
+// DiffStats summarizes a diff.
+type DiffStats struct {
+	Added     int
+	Removed   int
+	Changed   int
+	Unchanged int
+	OldTotal  int64
+	NewTotal  int64
+}
+
+// Diff streams two alphabetical TSV results in lockstep and calls emit for
+// every added, removed and changed word, in word order.
+func (s *Service) Diff(ctx context.Context, oldResultFileName, newResultFileName string, emit func(d WordDiff) error) (stats DiffStats, err error) {
+	ctx, end := s.startJob(ctx, "diff", slog.String("old", oldResultFileName), slog.String("new", newResultFileName))
+	defer end(&err)
+
+	oldFile, err := s.storage.OpenInputFile(oldResultFileName)
+	if err != nil {
+		return stats, fmt.Errorf("open old result failed, error=%w", err)
+	}
+	defer func() {
+		if closeErr := oldFile.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close old result, err=%w", closeErr))
+		}
+	}()
+	newFile, err := s.storage.OpenInputFile(newResultFileName)
+	if err != nil {
+		return stats, fmt.Errorf("open new result failed, error=%w", err)
+	}
+	defer func() {
+		if closeErr := newFile.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close new result, err=%w", closeErr))
+		}
+	}()
+
+	oldRows := &sortedRows{file: &resultRunFile{InputFile: oldFile}, name: oldResultFileName}
+	newRows := &sortedRows{file: &resultRunFile{InputFile: newFile}, name: newResultFileName}
+	if err := oldRows.next(); err != nil {
+		return stats, err
+	}
+	if err := newRows.next(); err != nil {
+		return stats, err
+	}
+
+	for oldRows.ok || newRows.ok {
+		select {
+		case <-ctx.Done():
+			return stats, fmt.Errorf("context cancelled, err if any=%w", ctx.Err())
+		default: // just continue
+		}
+
+		var d WordDiff
+		switch {
+		case !newRows.ok || (oldRows.ok && oldRows.word < newRows.word):
+			d = WordDiff{Word: oldRows.word, Kind: DiffRemoved, Old: oldRows.count}
+			err = oldRows.next()
+		case !oldRows.ok || newRows.word < oldRows.word:
+			d = WordDiff{Word: newRows.word, Kind: DiffAdded, New: newRows.count}
+			err = newRows.next()
+		default:
+			d = WordDiff{Word: oldRows.word, Kind: DiffChanged, Old: oldRows.count, New: newRows.count}
+			err = errors.Join(oldRows.next(), newRows.next())
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		stats.OldTotal, err = s.addCounts("old total", stats.OldTotal, d.Old)
+		if err != nil {
+			return stats, err
+		}
+		stats.NewTotal, err = s.addCounts("new total", stats.NewTotal, d.New)
+		if err != nil {
+			return stats, err
+		}
+		switch {
+		case d.Kind == DiffAdded:
+			stats.Added++
+		case d.Kind == DiffRemoved:
+			stats.Removed++
+		case d.Old == d.New:
+			stats.Unchanged++
+			continue
+		default:
+			stats.Changed++
+		}
+
+		d.Delta = d.New - d.Old
+		if d.Old == 0 {
+			d.Relative = math.Inf(1)
+		} else {
+			d.Relative = float64(d.Delta) / float64(d.Old)
+		}
+		if err := emit(d); err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// sortedRows reads a result file row by row and checks it is in word order.
+type sortedRows struct {
+	file  InputFile
+	name  string
+	ok    bool
+	word  string
+	count int64
+}
+
+func (r *sortedRows) next() error {
+	if !r.file.Scan() {
+		r.ok = false
+		if err := r.file.Err(); err != nil {
+			return fmt.Errorf("read %s failed, error=%w", r.name, err)
+		}
+		return nil
+	}
+
+	word, count, err := r.file.ReadMappedLine()
+	if err != nil {
+		return fmt.Errorf("bad line in %s, error=%w", r.name, err)
+	}
+	if r.ok && word <= r.word {
+		return fmt.Errorf("%s is not sorted by word, %q after %q", r.name, word, r.word)
+	}
+	r.ok, r.word, r.count = true, word, count
+
+	return nil
+}
+
+// DiffTopN keeps the n diffs with the largest absolute delta.
+type DiffTopN struct {
+	n     int
+	diffs diffHeap
+}
+
+// NewDiffTopN creates a collector of the n largest changes.
+func NewDiffTopN(n int) *DiffTopN {
+	return &DiffTopN{n: n}
+}
+
+// Add is meant to be passed to Diff as emit.
+func (t *DiffTopN) Add(d WordDiff) error {
+	if t.diffs.Len() < t.n {
+		heap.Push(&t.diffs, d)
+		return nil
+	}
+	if t.n == 0 || !t.diffs.less(t.diffs[0], d) {
+		return nil
+	}
+	t.diffs[0] = d
+	heap.Fix(&t.diffs, 0)
+
+	return nil
+}
+
+// Result returns collected diffs, the largest change first.
+func (t *DiffTopN) Result() []WordDiff {
+	res := make([]WordDiff, len(t.diffs))
+	copy(res, t.diffs)
+	sort.Slice(res, func(i, j int) bool {
+		return t.diffs.less(res[j], res[i])
+	})
+
+	return res
+}
+
+// min-heap of diffs by absolute delta, ties broken by word like CountHeap
+type diffHeap []WordDiff
+
+func (h diffHeap) less(a, b WordDiff) bool {
+	if absInt(a.Delta) != absInt(b.Delta) {
+		return absInt(a.Delta) < absInt(b.Delta)
+	}
+	return a.Word > b.Word
+}
+
+func (h diffHeap) Len() int           { return len(h) }
+func (h diffHeap) Less(i, j int) bool { return h.less(h[i], h[j]) }
+func (h diffHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *diffHeap) Push(x interface{}) {
+	*h = append(*h, x.(WordDiff))
+}
+
+func (h *diffHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+func absInt(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,65 @@
+package mapreduce_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+	mapReduceMocks "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce/mocks"
+)
+
+func mockResultFile(lines ...string) *mapReduceMocks.InputFile {
+	f := new(mapReduceMocks.InputFile)
+	for _, line := range lines {
+		f.On("Scan").Return(true).Once()
+		f.On("ReadLine").Return(line).Once()
+	}
+	f.On("Scan").Return(false).Once()
+	f.On("Err").Return(nil)
+	f.On("Close").Return(nil)
+
+	return f
+}
+
+func TestService_Diff(t *testing.T) {
+	mockStorage := new(mapReduceMocks.Storage)
+	mockStorage.On("OpenInputFile", "old.tsv").Return(mockResultFile("a\t2", "b\t4", "c\t1", "d\t5"), nil)
+	mockStorage.On("OpenInputFile", "new.tsv").Return(mockResultFile("word\tcount", "b\t1", "c\t1", "d\t15", "e\t3"), nil)
+	svc := mapreduce.NewService(10, 1, mockStorage)
+
+	var diffs []mapreduce.WordDiff
+	top := mapreduce.NewDiffTopN(2)
+	stats, err := svc.Diff(context.Background(), "old.tsv", "new.tsv", func(d mapreduce.WordDiff) error {
+		diffs = append(diffs, d)
+		return top.Add(d)
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []mapreduce.WordDiff{
+		{Word: "a", Kind: mapreduce.DiffRemoved, Old: 2, New: 0, Delta: -2, Relative: -1},
+		{Word: "b", Kind: mapreduce.DiffChanged, Old: 4, New: 1, Delta: -3, Relative: -0.75},
+		{Word: "d", Kind: mapreduce.DiffChanged, Old: 5, New: 15, Delta: 10, Relative: 2},
+		{Word: "e", Kind: mapreduce.DiffAdded, Old: 0, New: 3, Delta: 3, Relative: math.Inf(1)},
+	}, diffs)
+	assert.Equal(t, mapreduce.DiffStats{Added: 1, Removed: 1, Changed: 2, Unchanged: 1, OldTotal: 12, NewTotal: 20}, stats)
+
+	topDiffs := top.Result()
+	assert.Len(t, topDiffs, 2)
+	assert.Equal(t, "d", topDiffs[0].Word)
+	assert.Equal(t, "b", topDiffs[1].Word)
+}
+
+func TestService_Diff_Unsorted(t *testing.T) {
+	mockStorage := new(mapReduceMocks.Storage)
+	mockStorage.On("OpenInputFile", "old.tsv").Return(mockResultFile("b\t1", "a\t1"), nil)
+	mockStorage.On("OpenInputFile", "new.tsv").Return(mockResultFile("a\t1"), nil)
+	svc := mapreduce.NewService(10, 1, mockStorage)
+
+	_, err := svc.Diff(context.Background(), "old.tsv", "new.tsv", func(d mapreduce.WordDiff) error {
+		return nil
+	})
+	assert.ErrorContains(t, err, "not sorted")
+}
@@ -0,0 +1,22 @@
+package mapreduce
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardHandler drops every record, it is the default of a Service without a logger.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// WithLogger makes the Service log jobs at info level, and every spill and
+// merge at debug level.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = logger
+	}
+}
@@ -0,0 +1,65 @@
+package mapreduce_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memoryAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/memory"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// logRecords decodes JSON log lines, grouped by message.
+func logRecords(t *testing.T, buf *bytes.Buffer) map[string][]map[string]any {
+	records := make(map[string][]map[string]any)
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		var record map[string]any
+		require.NoError(t, decoder.Decode(&record))
+		msg := record[slog.MessageKey].(string)
+		records[msg] = append(records[msg], record)
+	}
+
+	return records
+}
+
+func TestService_Do_Logger(t *testing.T) {
+	storage := memoryAdapter.NewStorage()
+	storage.Put("input.txt", []byte("b\na\nb\nc\n\nb\nd\na\n"))
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	svc := mapreduce.NewService(2, 1, storage, mapreduce.WithLogger(logger))
+
+	result, _, err := svc.Do(context.Background(), "input.txt")
+	require.NoError(t, err)
+	_, _, err = svc.Do(context.Background(), "missing.txt")
+	require.Error(t, err)
+
+	records := logRecords(t, &buf)
+	require.Len(t, records["job started"], 2)
+	assert.Equal(t, "do", records["job started"][0]["job"])
+	assert.Equal(t, "input.txt", records["job started"][0]["input"])
+	require.Len(t, records["job finished"], 1)
+	assert.Contains(t, records["job finished"][0], "duration")
+	require.Len(t, records["job failed"], 1)
+	assert.Equal(t, "missing.txt", records["job failed"][0]["input"])
+	assert.Contains(t, records["job failed"][0]["error"], "missing.txt")
+
+	// a 1, b 2 | b 1, c 1 | b 1, d 1 | a 1
+	spills := records["spill written"]
+	require.Len(t, spills, 4)
+	assert.EqualValues(t, 2, spills[0]["keys"])
+	assert.EqualValues(t, 8, spills[0]["bytes"])
+	assert.EqualValues(t, 1, spills[3]["keys"])
+
+	merges := records["merge finished"]
+	require.NotEmpty(t, merges)
+	last := merges[len(merges)-1]
+	assert.Equal(t, result, last["output"])
+	assert.Len(t, last["inputs"], 2)
+}
@@ -0,0 +1,215 @@
+package mapreduce
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultIndexInterval is how many rows of the result share one index entry.
+const DefaultIndexInterval = 1024
+
+// RangeStorage is a Storage that can also open a file from a byte offset,
+// it is needed to look words up in a result file without reading all of it.
+type RangeStorage interface {
+	Storage
+	OpenInputFileAt(name string, offset int64) (InputFile, error)
+}
+
+// indexedWriter is the TSV ResultWriter that also writes a sparse index: the
+// word and byte offset of every interval-th row.
+type indexedWriter struct {
+	out      OutputFile
+	index    OutputFile
+	interval int
+	offset   int64
+	rows     int
+	last     string // word of the last row, rows must be strictly ascending
+}
+
+// NewIndexedResultWriter creates a TSV writer on top of out that writes a
+// sparse index of it to index. Lookup needs the result in word order, a word
+// that doesn't follow the previous one fails the write.
+func NewIndexedResultWriter(out, index OutputFile, header bool, interval int) (ResultWriter, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("index interval should be positive, got %d", interval)
+	}
+	w := &indexedWriter{out: out, index: index, interval: interval}
+	if header {
+		line := "word\tcount\n"
+		if err := out.Write(line); err != nil {
+			return nil, fmt.Errorf("write header failed, error=%w", err)
+		}
+		w.offset += int64(len(line))
+	}
+
+	return w, nil
+}
+
+func (w *indexedWriter) Write(word string, count int64) error {
+	if w.rows > 0 && word <= w.last {
+		return fmt.Errorf("indexed result must be in strictly ascending word order, got %q after %q", word, w.last)
+	}
+	w.last = word
+
+	escaped := tsvEscaper.Replace(word)
+	if w.rows%w.interval == 0 {
+		err := w.index.Write(escaped + "\t" + strconv.FormatInt(w.offset, 10) + "\n")
+		if err != nil {
+			return fmt.Errorf("index write failed, error=%w", err)
+		}
+	}
+	w.rows++
+
+	line := escaped + "\t" + strconv.FormatInt(count, 10) + "\n"
+	w.offset += int64(len(line))
+	return w.out.Write(line)
+}
+
+func (w *indexedWriter) Close() error {
+	return errors.Join(w.out.Close(), w.index.Close())
+}
+
+// Lookup answers point, prefix and range queries on a word ordered TSV result
+// file using its sparse index. Only the index is kept in memory.
+type Lookup struct {
+	storage        RangeStorage
+	resultFileName string
+	words          []string
+	offsets        []int64
+}
+
+// NewLookup loads the sparse index written by NewIndexedResultWriter.
+func NewLookup(storage RangeStorage, resultFileName, indexFileName string) (l *Lookup, err error) {
+	indexFile, err := storage.OpenInputFile(indexFileName)
+	if err != nil {
+		return nil, fmt.Errorf("open index file failed, error=%w", err)
+	}
+	defer func() {
+		if closeErr := indexFile.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close index file, err=%w", closeErr))
+		}
+	}()
+
+	l = &Lookup{storage: storage, resultFileName: resultFileName}
+	for indexFile.Scan() {
+		word, offset, err := parseTSVRow(indexFile.ReadLine())
+		if err != nil {
+			return nil, fmt.Errorf("bad index line, error=%w", err)
+		}
+		l.words = append(l.words, word)
+		l.offsets = append(l.offsets, int64(offset))
+	}
+	if err := indexFile.Err(); err != nil {
+		return nil, fmt.Errorf("read index file failed, error=%w", err)
+	}
+
+	return l, nil
+}
+
+// Get returns the count of the word, found is false if the word is not in the result.
+func (l *Lookup) Get(word string) (count int64, found bool, err error) {
+	err = l.scanFrom(word, func(w string, c int64) (bool, error) {
+		if w == word {
+			count, found = c, true
+		}
+		return false, nil
+	})
+
+	return count, found, err
+}
+
+// Range streams words from inclusive to exclusive in word order, an empty to
+// means no upper bound.
+func (l *Lookup) Range(from, to string, emit func(word string, count int64) error) error {
+	return l.scanFrom(from, func(word string, count int64) (bool, error) {
+		if to != "" && word >= to {
+			return false, nil
+		}
+		if err := emit(word, count); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+}
+
+// Prefix streams all words starting with prefix in word order.
+func (l *Lookup) Prefix(prefix string, emit func(word string, count int64) error) error {
+	return l.Range(prefix, prefixEnd(prefix), emit)
+}
+
+// scanFrom reads rows starting with the first word >= from and calls visit
+// until it returns false.
+func (l *Lookup) scanFrom(from string, visit func(word string, count int64) (bool, error)) (err error) {
+	if len(l.offsets) == 0 {
+		return nil
+	}
+	// last index entry <= from, the word can't be before it
+	i := sort.SearchStrings(l.words, from)
+	if i == len(l.words) || l.words[i] != from {
+		i--
+	}
+	if i < 0 {
+		i = 0
+	}
+
+	resultFile, err := l.storage.OpenInputFileAt(l.resultFileName, l.offsets[i])
+	if err != nil {
+		return fmt.Errorf("open result file failed, error=%w", err)
+	}
+	defer func() {
+		if closeErr := resultFile.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close result file, err=%w", closeErr))
+		}
+	}()
+
+	for resultFile.Scan() {
+		word, count, err := parseTSVRow(resultFile.ReadLine())
+		if err != nil {
+			return fmt.Errorf("bad result line, error=%w", err)
+		}
+		if word < from {
+			continue
+		}
+		more, err := visit(word, count)
+		if err != nil || !more {
+			return err
+		}
+	}
+	if err := resultFile.Err(); err != nil {
+		return fmt.Errorf("read result file failed, error=%w", err)
+	}
+
+	return nil
+}
+
+var tsvUnescaper = strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\r`, "\r")
+
+// parseTSVRow parses a line written by the TSV result writer.
+func parseTSVRow(line string) (string, int64, error) {
+	i := strings.LastIndexByte(line, '\t')
+	if i < 0 {
+		return "", 0, fmt.Errorf("line should be word and number separated by tab, got %q", line)
+	}
+	n, err := strconv.ParseInt(line[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("second part in line should be integer, but was not. Error=%w", err)
+	}
+
+	return tsvUnescaper.Replace(line[:i]), n, nil
+}
+
+// prefixEnd returns the smallest string greater than all strings with the
+// prefix, or "" if there is none.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
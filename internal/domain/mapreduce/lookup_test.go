@@ -0,0 +1,82 @@
+package mapreduce_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	fileAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/file"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	resultFileName := filepath.Join(dir, "output.tsv")
+	indexFileName := filepath.Join(dir, "output.tsv.idx")
+	storage := fileAdapter.NewStorage()
+
+	out, err := storage.CreateOutputFile(resultFileName)
+	require.NoError(t, err)
+	index, err := storage.CreateOutputFile(indexFileName)
+	require.NoError(t, err)
+	w, err := mapreduce.NewIndexedResultWriter(out, index, true, 3)
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		require.NoError(t, w.Write(fmt.Sprintf("w%02d", i), int64(i+1)))
+	}
+	require.NoError(t, w.Write("x\ty", 100))
+	require.NoError(t, w.Close())
+
+	l, err := mapreduce.NewLookup(storage, resultFileName, indexFileName)
+	require.NoError(t, err)
+
+	for _, word := range []string{"w00", "w05", "w06", "w19"} {
+		count, found, err := l.Get(word)
+		assert.NoError(t, err)
+		assert.True(t, found, word)
+		assert.Equal(t, word, fmt.Sprintf("w%02d", count-1))
+	}
+	count, found, err := l.Get("x\ty")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(100), count)
+	for _, word := range []string{"a", "w055", "z"} {
+		_, found, err := l.Get(word)
+		assert.NoError(t, err)
+		assert.False(t, found, word)
+	}
+
+	var words []string
+	collect := func(word string, count int64) error {
+		words = append(words, word)
+		return nil
+	}
+	assert.NoError(t, l.Prefix("w1", collect))
+	assert.Len(t, words, 10)
+	assert.Equal(t, "w10", words[0])
+	assert.Equal(t, "w19", words[9])
+
+	words = nil
+	assert.NoError(t, l.Range("w04", "w07", collect))
+	assert.Equal(t, []string{"w04", "w05", "w06"}, words)
+}
+
+func TestIndexedResultWriter_Unsorted(t *testing.T) {
+	dir := t.TempDir()
+	storage := fileAdapter.NewStorage()
+	out, err := storage.CreateOutputFile(filepath.Join(dir, "output.tsv"))
+	require.NoError(t, err)
+	index, err := storage.CreateOutputFile(filepath.Join(dir, "output.tsv.idx"))
+	require.NoError(t, err)
+	w, err := mapreduce.NewIndexedResultWriter(out, index, false, 3)
+	require.NoError(t, err)
+	defer w.Close()
+
+	require.NoError(t, w.Write("b", 1))
+	assert.ErrorContains(t, w.Write("b", 2), "ascending")
+	assert.ErrorContains(t, w.Write("a", 3), "ascending")
+	assert.NoError(t, w.Write("c", 4))
+}
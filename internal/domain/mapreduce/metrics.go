@@ -0,0 +1,148 @@
+package mapreduce
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metrics counts what the jobs of a Service do, for monitoring long jobs.
+// It is safe for concurrent use; one Metrics can be shared by several
+// Services, a nil Metrics counts nothing.
+type Metrics struct {
+	lines         atomic.Int64
+	words         atomic.Int64
+	uniqueKeys    atomic.Int64
+	spillFiles    atomic.Int64
+	spillBytes    atomic.Int64
+	merges        atomic.Int64
+	mergeFanIn    atomic.Int64
+	activeWorkers atomic.Int64
+	mapNanos      atomic.Int64
+	reduceNanos   atomic.Int64
+	mapErrors     atomic.Int64
+	reduceErrors  atomic.Int64
+}
+
+// MetricValues is a point in time copy of Metrics.
+type MetricValues struct {
+	// Lines read by the map phase, Words are the non-empty ones.
+	Lines int64
+	Words int64
+	// UniqueKeys are words counted in memory, not spilled yet.
+	UniqueKeys int64
+	SpillFiles int64
+	SpillBytes int64
+	// Merges of sorted files done, MergeFanIn is the number of files the
+	// latest one read.
+	Merges         int64
+	MergeFanIn     int64
+	ActiveWorkers  int64
+	MapDuration    time.Duration
+	ReduceDuration time.Duration
+	MapErrors      int64
+	ReduceErrors   int64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// WithMetrics counts the jobs of the Service into m.
+func WithMetrics(m *Metrics) Option {
+	return func(s *Service) {
+		s.metrics = m
+	}
+}
+
+// Values returns the current values.
+func (m *Metrics) Values() MetricValues {
+	return MetricValues{
+		Lines:          m.lines.Load(),
+		Words:          m.words.Load(),
+		UniqueKeys:     m.uniqueKeys.Load(),
+		SpillFiles:     m.spillFiles.Load(),
+		SpillBytes:     m.spillBytes.Load(),
+		Merges:         m.merges.Load(),
+		MergeFanIn:     m.mergeFanIn.Load(),
+		ActiveWorkers:  m.activeWorkers.Load(),
+		MapDuration:    time.Duration(m.mapNanos.Load()),
+		ReduceDuration: time.Duration(m.reduceNanos.Load()),
+		MapErrors:      m.mapErrors.Load(),
+		ReduceErrors:   m.reduceErrors.Load(),
+	}
+}
+
+func (m *Metrics) read(lines, words, uniqueKeys int64) {
+	if m == nil {
+		return
+	}
+	m.lines.Add(lines)
+	m.words.Add(words)
+	m.uniqueKeys.Store(uniqueKeys)
+}
+
+func (m *Metrics) spilled(bytes int64) {
+	if m == nil {
+		return
+	}
+	m.spillFiles.Add(1)
+	m.spillBytes.Add(bytes)
+}
+
+func (m *Metrics) mergeStarted(fanIn int) {
+	if m == nil {
+		return
+	}
+	m.merges.Add(1)
+	m.mergeFanIn.Store(int64(fanIn))
+}
+
+func (m *Metrics) workerStarted() {
+	if m == nil {
+		return
+	}
+	m.activeWorkers.Add(1)
+}
+
+func (m *Metrics) workerDone() {
+	if m == nil {
+		return
+	}
+	m.activeWorkers.Add(-1)
+}
+
+// mapDone adds the duration of a map phase that started at start.
+func (m *Metrics) mapDone(start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.uniqueKeys.Store(0)
+	m.mapNanos.Add(int64(time.Since(start)))
+	if err != nil {
+		m.mapErrors.Add(1)
+	}
+}
+
+// reduceDone adds the duration of a merge phase that started at start.
+func (m *Metrics) reduceDone(start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.reduceNanos.Add(int64(time.Since(start)))
+	if err != nil {
+		m.reduceErrors.Add(1)
+	}
+}
+
+// recordSize is the length of the "word\tcount\n" line of a record.
+func recordSize(word string, count int64) int64 {
+	size := int64(len(word)) + 3 // tab, newline and the first digit
+	if count < 0 {
+		size++
+		count = -count
+	}
+	for ; count >= 10; count /= 10 {
+		size++
+	}
+	return size
+}
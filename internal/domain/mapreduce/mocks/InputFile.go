@@ -64,7 +64,7 @@ func (_m *InputFile) ReadLine() string {
 }
 
 // ReadMappedLine provides a mock function with given fields:
-func (_m *InputFile) ReadMappedLine() (string, int, error) {
+func (_m *InputFile) ReadMappedLine() (string, int64, error) {
 	ret := _m.Called()
 
 	if len(ret) == 0 {
@@ -72,9 +72,9 @@ func (_m *InputFile) ReadMappedLine() (string, int, error) {
 	}
 
 	var r0 string
-	var r1 int
+	var r1 int64
 	var r2 error
-	if rf, ok := ret.Get(0).(func() (string, int, error)); ok {
+	if rf, ok := ret.Get(0).(func() (string, int64, error)); ok {
 		return rf()
 	}
 	if rf, ok := ret.Get(0).(func() string); ok {
@@ -83,10 +83,47 @@ func (_m *InputFile) ReadMappedLine() (string, int, error) {
 		r0 = ret.Get(0).(string)
 	}
 
-	if rf, ok := ret.Get(1).(func() int); ok {
+	if rf, ok := ret.Get(1).(func() int64); ok {
 		r1 = rf()
 	} else {
-		r1 = ret.Get(1).(int)
+		r1 = ret.Get(1).(int64)
+	}
+
+	if rf, ok := ret.Get(2).(func() error); ok {
+		r2 = rf()
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// ReadRecord provides a mock function with given fields:
+func (_m *InputFile) ReadRecord() ([]byte, int64, error) {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReadRecord")
+	}
+
+	var r0 []byte
+	var r1 int64
+	var r2 error
+	if rf, ok := ret.Get(0).(func() ([]byte, int64, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() []byte); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func() int64); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Get(1).(int64)
 	}
 
 	if rf, ok := ret.Get(2).(func() error); ok {
@@ -45,6 +45,24 @@ func (_m *OutputFile) Write(line string) error {
 	return r0
 }
 
+// WriteRecord provides a mock function with given fields: key, count
+func (_m *OutputFile) WriteRecord(key []byte, count int64) error {
+	ret := _m.Called(key, count)
+
+	if len(ret) == 0 {
+		panic("no return value specified for WriteRecord")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func([]byte, int64) error); ok {
+		r0 = rf(key, count)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewOutputFile creates a new instance of OutputFile. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewOutputFile(t interface {
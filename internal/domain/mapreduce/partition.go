@@ -0,0 +1,222 @@
+package mapreduce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sort"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// PartitionIndexFileName lists partition files with their key ranges.
+const PartitionIndexFileName = "part-index.tsv"
+
+// Partitioner assigns every word to one of Partitions() output shards.
+type Partitioner interface {
+	Partitions() int
+	Partition(word string) int
+}
+
+type hashPartitioner struct {
+	partitions int
+}
+
+// NewHashPartitioner spreads words over p partitions by FNV-1a hash of the word.
+func NewHashPartitioner(p int) (Partitioner, error) {
+	if p <= 0 {
+		return nil, fmt.Errorf("number of partitions should be positive, got %d", p)
+	}
+	return &hashPartitioner{partitions: p}, nil
+}
+
+func (h *hashPartitioner) Partitions() int {
+	return h.partitions
+}
+
+func (h *hashPartitioner) Partition(word string) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(word))
+	return int(hash.Sum32() % uint32(h.partitions))
+}
+
+type rangePartitioner struct {
+	bounds []string
+}
+
+// NewRangePartitioner splits words by key range: partition i holds words
+// from bounds[i-1] inclusive to bounds[i] exclusive, so len(bounds)+1
+// partitions in total. Bounds should be sorted and unique.
+func NewRangePartitioner(bounds []string) (Partitioner, error) {
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i-1] >= bounds[i] {
+			return nil, fmt.Errorf("partition bounds should be sorted and unique, got %q before %q", bounds[i-1], bounds[i])
+		}
+	}
+	return &rangePartitioner{bounds: bounds}, nil
+}
+
+func (r *rangePartitioner) Partitions() int {
+	return len(r.bounds) + 1
+}
+
+func (r *rangePartitioner) Partition(word string) int {
+	return sort.Search(len(r.bounds), func(i int) bool {
+		return r.bounds[i] > word
+	})
+}
+
+// PartitionInfo describes one output shard. FirstWord and LastWord are empty
+// for an empty shard.
+type PartitionInfo struct {
+	FileName  string
+	FirstWord string
+	LastWord  string
+	Rows      int
+}
+
+// DoPartitioned counts words of the input like Do, but splits the result into
+// part-00000.tsv, part-00001.tsv... files, one per partition, and writes an
+// index of them to PartitionIndexFileName, in the WithResultStorage storage
+// if there is one. Each shard is sorted by word.
+// Partitions are reduced independently, up to workers at a time.
+func (s *Service) DoPartitioned(ctx context.Context, inputFileName string, partitioner Partitioner) (_ []PartitionInfo, err error) {
+	ctx, end := s.startJob(ctx, "partition", slog.String("input", inputFileName), slog.Int("partitions", partitioner.Partitions()))
+	defer end(&err)
+
+	partitionFiles, err := s.mapAndShufflePartitioned(ctx, inputFileName, partitioner)
+	if err != nil {
+		return nil, fmt.Errorf("map and shuffle stage failed, error=%w", err)
+	}
+
+	parts := make([]PartitionInfo, partitioner.Partitions())
+	eg := &errgroup.Group{}
+	if s.workers > 0 {
+		eg.SetLimit(s.workers)
+	}
+	for p := range parts {
+		eg.Go(func() error {
+			s.metrics.workerStarted()
+			defer s.metrics.workerDone()
+			info, err := s.reducePartition(ctx, p, partitionFiles[p])
+			if err != nil {
+				return fmt.Errorf("reduce partition %d failed, error=%w", p, err)
+			}
+			parts[p] = info
+
+			return nil
+		})
+	}
+	err = eg.Wait()
+	if err != nil {
+		return nil, fmt.Errorf("reduce stage failed, error=%w", err)
+	}
+
+	err = s.writePartitionIndex(parts)
+	if err != nil {
+		return nil, err
+	}
+
+	return parts, nil
+}
+
+func (s *Service) mapAndShufflePartitioned(ctx context.Context, inputFileName string, partitioner Partitioner) ([][]string, error) {
+	partitionFiles := make([][]string, partitioner.Partitions())
+	_, err := s.mapInput(ctx, inputFileName, false, func(ctx context.Context, wordCount map[string]int64, fileIndex int) error {
+		buckets := make([][]string, len(partitionFiles))
+		for word := range wordCount {
+			p := partitioner.Partition(word)
+			buckets[p] = append(buckets[p], word)
+		}
+
+		for p, words := range buckets {
+			if len(words) == 0 {
+				continue
+			}
+			sortInPlace(&words)
+			tempFileName := s.tempName(fmt.Sprintf("temp_%d_part_%d.tsv", fileIndex, p))
+			err := s.writeTempFile(ctx, tempFileName, words, wordCount)
+			if err != nil {
+				return fmt.Errorf("write partition temp file failed, error=%w", err)
+			}
+			partitionFiles[p] = append(partitionFiles[p], tempFileName)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return partitionFiles, nil
+}
+
+func (s *Service) reducePartition(ctx context.Context, p int, tempFiles []string) (info PartitionInfo, err error) {
+	info.FileName = fmt.Sprintf("part-%05d.tsv", p)
+	out, err := s.results().CreateOutputFile(info.FileName)
+	if err != nil {
+		return info, fmt.Errorf("failed to create partition file in storage, err=%w", err)
+	}
+	writer, err := NewResultWriter(out, FormatTSV, false)
+	if err != nil {
+		return info, errors.Join(err, out.Close())
+	}
+	defer func() {
+		closeErr := writer.Close()
+		if closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close partition file, err=%w", closeErr))
+		}
+	}()
+
+	if len(tempFiles) == 0 {
+		return info, nil
+	}
+
+	tempFiles, err = s.mergeRounds(ctx, tempFiles, 2, SortByWord, fmt.Sprintf("merged_part_%d", p))
+	if err != nil {
+		return info, err
+	}
+	err = s.mergeSorted(ctx, tempFiles, SortByWord, info.FileName, func(word string, count int64) error {
+		if info.Rows == 0 {
+			info.FirstWord = word
+		}
+		info.LastWord = word
+		info.Rows++
+
+		return writer.Write(word, count)
+	})
+	if err != nil {
+		return info, fmt.Errorf("final merge failed, err=%w", err)
+	}
+
+	return info, nil
+}
+
+func (s *Service) writePartitionIndex(parts []PartitionInfo) (err error) {
+	writer, err := s.results().CreateOutputFile(PartitionIndexFileName)
+	if err != nil {
+		return fmt.Errorf("failed to create partition index in storage, err=%w", err)
+	}
+	defer func() {
+		closeErr := writer.Close()
+		if closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close partition index, err=%w", closeErr))
+		}
+	}()
+
+	err = writer.Write("file\tfirst_word\tlast_word\trows\n")
+	if err != nil {
+		return fmt.Errorf("partition index write failed, error=%w", err)
+	}
+	for _, part := range parts {
+		line := fmt.Sprintf("%s\t%s\t%s\t%d\n", part.FileName, tsvEscaper.Replace(part.FirstWord), tsvEscaper.Replace(part.LastWord), part.Rows)
+		err := writer.Write(line)
+		if err != nil {
+			return fmt.Errorf("partition index write failed, error=%w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package mapreduce_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+func TestRangePartitioner(t *testing.T) {
+	partitioner, err := mapreduce.NewRangePartitioner([]string{"f", "p"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, partitioner.Partitions())
+
+	assert.Equal(t, 0, partitioner.Partition("apple"))
+	assert.Equal(t, 1, partitioner.Partition("f"))
+	assert.Equal(t, 1, partitioner.Partition("orange"))
+	assert.Equal(t, 2, partitioner.Partition("p"))
+	assert.Equal(t, 2, partitioner.Partition("zebra"))
+
+	_, err = mapreduce.NewRangePartitioner([]string{"p", "f"})
+	assert.Error(t, err)
+}
+
+func TestHashPartitioner(t *testing.T) {
+	partitioner, err := mapreduce.NewHashPartitioner(4)
+	assert.NoError(t, err)
+
+	for _, word := range []string{"a", "b", "hello", "world", ""} {
+		p := partitioner.Partition(word)
+		assert.GreaterOrEqual(t, p, 0)
+		assert.Less(t, p, 4)
+		assert.Equal(t, p, partitioner.Partition(word))
+	}
+
+	_, err = mapreduce.NewHashPartitioner(0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,198 @@
+package mapreduce
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// progressBatch is how many lines the mapper counts before it updates the
+// shared progress, so the hot loop doesn't take a lock per line.
+const progressBatch = 4096
+
+// InputSizer is implemented by sources that know the size of an input in
+// bytes before it is read, progress reports use it for the map phase ETA.
+type InputSizer interface {
+	InputSize(name string) (int64, error)
+}
+
+// Phase is the stage a job is in.
+type Phase int
+
+const (
+	// PhaseMap reads inputs and spills sorted counts.
+	PhaseMap Phase = iota
+	// PhaseReduce merges the spills in rounds.
+	PhaseReduce
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseMap:
+		return "map"
+	case PhaseReduce:
+		return "reduce"
+	default:
+		return fmt.Sprintf("Phase(%d)", int(p))
+	}
+}
+
+// Progress is a snapshot of a running job.
+type Progress struct {
+	Phase Phase
+	// BytesRead counts the lines read so far with their line breaks.
+	BytesRead int64
+	// InputSize is the total size of the inputs opened so far, 0 if unknown.
+	InputSize int64
+	Lines     int64
+	Spills    int
+	// MergeRounds of MergeRoundsTotal are done, the total grows when a job
+	// merges more than once, e.g. to sort the result.
+	MergeRounds      int
+	MergeRoundsTotal int
+	Elapsed          time.Duration
+	// PhaseElapsed is the time since the current phase started.
+	PhaseElapsed time.Duration
+}
+
+// Throughput is the average of bytes read per second since the job started.
+func (p Progress) Throughput() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.BytesRead) / p.Elapsed.Seconds()
+}
+
+// ETA estimates the time left in the current phase: by bytes read of the
+// input size while mapping and by rounds done while merging. ok is false
+// when there is nothing to estimate from yet.
+func (p Progress) ETA() (eta time.Duration, ok bool) {
+	var done, total float64
+	switch p.Phase {
+	case PhaseMap:
+		done, total = float64(p.BytesRead), float64(p.InputSize)
+	case PhaseReduce:
+		done, total = float64(p.MergeRounds), float64(p.MergeRoundsTotal)
+	}
+	if done <= 0 || total <= 0 {
+		return 0, false
+	}
+	if done >= total {
+		return 0, true
+	}
+
+	return time.Duration(float64(p.PhaseElapsed) * (total - done) / done), true
+}
+
+// WithProgress calls report with a snapshot of the running job at most once
+// per interval while mapping, and after every merge round. report is called
+// from the goroutine doing the work, it should be quick; to get the snapshots
+// on a channel send them with a non-blocking select.
+// The reports of a Service describe the job it runs, not jobs run concurrently.
+func WithProgress(interval time.Duration, report func(Progress)) Option {
+	return func(s *Service) {
+		s.progress = &progressTracker{interval: interval, report: report}
+	}
+}
+
+// progressTracker collects progress of a job, a nil tracker does nothing.
+type progressTracker struct {
+	interval time.Duration
+	report   func(Progress)
+
+	mu         sync.Mutex
+	progress   Progress
+	start      time.Time
+	phaseStart time.Time
+	lastReport time.Time
+}
+
+// begin resets the progress when a job starts mapping.
+func (t *progressTracker) begin() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	now := time.Now()
+	t.progress = Progress{Phase: PhaseMap}
+	t.start, t.phaseStart, t.lastReport = now, now, now
+	t.mu.Unlock()
+}
+
+func (t *progressTracker) addInputSize(size int64) {
+	t.update(false, func(p *Progress) {
+		p.InputSize += size
+	})
+}
+
+func (t *progressTracker) read(lines, bytes int64) {
+	t.update(false, func(p *Progress) {
+		p.Lines += lines
+		p.BytesRead += bytes
+	})
+}
+
+func (t *progressTracker) spilled() {
+	t.update(false, func(p *Progress) {
+		p.Spills++
+	})
+}
+
+func (t *progressTracker) mergeStarted(rounds int) {
+	if rounds == 0 {
+		return
+	}
+	t.update(true, func(p *Progress) {
+		p.MergeRoundsTotal += rounds
+	})
+}
+
+func (t *progressTracker) mergeRoundDone() {
+	t.update(true, func(p *Progress) {
+		p.MergeRounds++
+	})
+}
+
+// update changes the progress and reports it if forced or the interval passed.
+func (t *progressTracker) update(force bool, change func(p *Progress)) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	if t.start.IsZero() {
+		// merging without mapping first, e.g. Sort
+		t.start, t.phaseStart = now, now
+	}
+	before := t.progress.Phase
+	change(&t.progress)
+	if t.progress.MergeRoundsTotal > 0 {
+		t.progress.Phase = PhaseReduce
+	}
+	if t.progress.Phase != before {
+		t.phaseStart = now
+	}
+	t.progress.Elapsed = now.Sub(t.start)
+	t.progress.PhaseElapsed = now.Sub(t.phaseStart)
+	due := force || now.Sub(t.lastReport) >= t.interval
+	if due {
+		t.lastReport = now
+	}
+	snapshot := t.progress
+	t.mu.Unlock()
+
+	if due {
+		t.report(snapshot)
+	}
+}
+
+// mergeRoundsNeeded is how many rounds of pairwise merges bring files down to maxFiles.
+func mergeRoundsNeeded(files, maxFiles int) int {
+	rounds := 0
+	for files > maxFiles {
+		files = (files + 1) / 2
+		rounds++
+	}
+	return rounds
+}
@@ -0,0 +1,65 @@
+package mapreduce_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memoryAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/memory"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+func TestService_Do_Progress(t *testing.T) {
+	const input = "b\na\nb\nc\n\nb\nd\na\n"
+	storage := memoryAdapter.NewStorage()
+	storage.Put("input.txt", []byte(input))
+
+	var reports []mapreduce.Progress
+	svc := mapreduce.NewService(2, 1, storage, mapreduce.WithProgress(time.Hour, func(p mapreduce.Progress) {
+		reports = append(reports, p)
+	}))
+
+	_, _, err := svc.Do(context.Background(), "input.txt")
+	require.NoError(t, err)
+
+	// the interval never passes, only the start and the 2 merge rounds are
+	// reported: 4 spills of 2 unique words, then 4 -> 2 -> 1 files
+	require.Len(t, reports, 1+2)
+	assert.Equal(t, 0, reports[0].MergeRounds)
+	assert.Equal(t, 4, reports[0].Spills)
+	last := reports[len(reports)-1]
+	assert.Equal(t, mapreduce.PhaseReduce, last.Phase)
+	assert.Equal(t, int64(len(input)), last.BytesRead)
+	assert.Equal(t, int64(len(input)), last.InputSize)
+	assert.Equal(t, int64(8), last.Lines)
+	assert.Equal(t, 2, last.MergeRounds)
+	assert.Equal(t, 2, last.MergeRoundsTotal)
+	eta, ok := last.ETA()
+	assert.True(t, ok)
+	assert.Zero(t, eta)
+}
+
+func TestProgress_ETA(t *testing.T) {
+	tests := []struct {
+		name   string
+		p      mapreduce.Progress
+		want   time.Duration
+		wantOK bool
+	}{
+		{"map", mapreduce.Progress{Phase: mapreduce.PhaseMap, BytesRead: 25, InputSize: 100, PhaseElapsed: time.Minute}, 3 * time.Minute, true},
+		{"map unknown size", mapreduce.Progress{Phase: mapreduce.PhaseMap, BytesRead: 25, PhaseElapsed: time.Minute}, 0, false},
+		{"reduce", mapreduce.Progress{Phase: mapreduce.PhaseReduce, MergeRounds: 2, MergeRoundsTotal: 3, PhaseElapsed: time.Minute}, 30 * time.Second, true},
+		{"reduce not started", mapreduce.Progress{Phase: mapreduce.PhaseReduce, MergeRoundsTotal: 3}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eta, ok := tt.p.ETA()
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, eta)
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package mapreduce_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	fileAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/file"
+	memoryAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/memory"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// referenceCount is the word count done the trivial way: every line is a
+// word, split like bufio.ScanLines does, and the counts are sorted by word.
+func referenceCount(input []byte) []mapreduce.WordCount {
+	counts := make(map[string]int64)
+	scanner := bufio.NewScanner(bytes.NewReader(input))
+	scanner.Buffer(nil, len(input)+1)
+	for scanner.Scan() {
+		if word := scanner.Text(); word != "" {
+			counts[word]++
+		}
+	}
+
+	rows := make([]mapreduce.WordCount, 0, len(counts))
+	for word, count := range counts {
+		rows = append(rows, mapreduce.WordCount{Word: word, Count: count})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Word < rows[j].Word
+	})
+	return rows
+}
+
+// referenceFile is the result file Do writes for rows.
+func referenceFile(rows []mapreduce.WordCount) string {
+	var b strings.Builder
+	for _, row := range rows {
+		fmt.Fprintf(&b, "%s\t%d\n", row.Word, row.Count)
+	}
+	return b.String()
+}
+
+// referenceOrder is rows, sorted by word, in the given order.
+func referenceOrder(rows []mapreduce.WordCount, order mapreduce.SortOrder) []mapreduce.WordCount {
+	rows = slices.Clone(rows)
+	sort.SliceStable(rows, func(i, j int) bool {
+		switch order {
+		case mapreduce.SortByCount:
+			return rows[i].Count < rows[j].Count
+		case mapreduce.SortByCountDesc:
+			return rows[i].Count > rows[j].Count
+		default:
+			return false
+		}
+	})
+	return rows
+}
+
+// checkAgainstReference counts the input with Do and DoTo in every order
+// through the file storage in a temp dir, and compares them with the
+// reference. Workers only matter for DoPartitioned, the jobs run with one.
+func checkAgainstReference(t *testing.T, input []byte, n int, mmap bool) {
+	t.Helper()
+	dir := t.TempDir()
+	name := filepath.Join(dir, "input.txt")
+	require.NoError(t, os.WriteFile(name, input, 0o644))
+	var opts []fileAdapter.Option
+	if mmap {
+		opts = append(opts, fileAdapter.WithMmap())
+	}
+	svc := mapreduce.NewService(n, 1, fileAdapter.NewStorage(opts...), mapreduce.WithTempDir(dir))
+	want := referenceCount(input)
+
+	result, _, err := svc.Do(context.Background(), name)
+	if len(want) == 0 {
+		// an input without words has no result
+		require.ErrorContains(t, err, "nothing to reduce")
+		return
+	}
+	require.NoError(t, err)
+	data, err := os.ReadFile(result)
+	require.NoError(t, err)
+	require.Equal(t, referenceFile(want), string(data), "Do, N=%d mmap=%v", n, mmap)
+
+	for _, order := range []mapreduce.SortOrder{mapreduce.SortByWord, mapreduce.SortByCount, mapreduce.SortByCountDesc} {
+		w := &rowsWriter{}
+		_, err = svc.DoTo(context.Background(), name, order, w)
+		require.NoError(t, err)
+		require.Equal(t, referenceOrder(want, order), w.rows, "DoTo, N=%d mmap=%v order=%v", n, mmap, order)
+	}
+}
+
+// partitionEscaper escapes words of partition files like the tsv format.
+var partitionEscaper = strings.NewReplacer(`\\`, `\\\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// checkPartitioned counts the input with DoPartitioned in memory, and
+// compares every partition file with the rows of the reference the
+// partitioner puts into it.
+func checkPartitioned(t *testing.T, input []byte, n, workers int, partitioner mapreduce.Partitioner) {
+	t.Helper()
+	storage := memoryAdapter.NewStorage()
+	storage.Put("input.txt", input)
+	svc := mapreduce.NewService(n, workers, storage)
+
+	parts, err := svc.DoPartitioned(context.Background(), "input.txt", partitioner)
+	require.NoError(t, err)
+	require.Len(t, parts, partitioner.Partitions())
+
+	want := make([]strings.Builder, partitioner.Partitions())
+	rows := make([]int, partitioner.Partitions())
+	for _, row := range referenceCount(input) {
+		p := partitioner.Partition(row.Word)
+		fmt.Fprintf(&want[p], "%s\t%d\n", partitionEscaper.Replace(row.Word), row.Count)
+		rows[p]++
+	}
+	for p, part := range parts {
+		data, _ := storage.Get(part.FileName)
+		require.Equal(t, want[p].String(), string(data), "partition %d, N=%d workers=%d", p, n, workers)
+		require.Equal(t, rows[p], part.Rows, "partition %d", p)
+	}
+}
+
+// vocabularies are the kinds of words random inputs are made of.
+var vocabularies = map[string]func(r *rand.Rand) string{
+	"ascii": func(r *rand.Rand) string {
+		return fmt.Sprintf("w%d", r.IntN(50))
+	},
+	"unicode": func(r *rand.Rand) string {
+		words := []string{"é", "e", "É", "日本", "日本語", "ß", "ss", "😀", "Ω", "ω", " ", "á", "á"}
+		return words[r.IntN(len(words))]
+	},
+	// words sharing prefixes and with bytes that sort around tab and newline
+	"prefixes": func(r *rand.Rand) string {
+		words := []string{"a", "ab", "abc", "a b", "a\tb", "a\x01", "a\x7f", "a\xff", "a\rb", "~", "!"}
+		return words[r.IntN(len(words))]
+	},
+	"long": func(r *rand.Rand) string {
+		return strings.Repeat(string(rune('a'+r.IntN(3))), 1+r.IntN(5000))
+	},
+	"duplicate": func(*rand.Rand) string {
+		return "same"
+	},
+}
+
+// randomInput is lines of words from vocabulary, with empty lines, CRLF line
+// ends and an unterminated last line mixed in.
+func randomInput(r *rand.Rand, vocabulary func(r *rand.Rand) string) []byte {
+	var b bytes.Buffer
+	lines := r.IntN(300)
+	for i := 0; i < lines; i++ {
+		switch r.IntN(20) {
+		case 0:
+			b.WriteString("\n")
+		case 1:
+			b.WriteString(vocabulary(r) + "\r\n")
+		default:
+			b.WriteString(vocabulary(r) + "\n")
+		}
+	}
+	if r.IntN(2) == 0 {
+		b.WriteString(vocabulary(r))
+	}
+	return b.Bytes()
+}
+
+// TestService_Do_Property runs jobs of random inputs with random N, the
+// number of spills and so the depth of the pairwise merge tree follow from
+// it. A failing case is reproduced with its seed.
+func TestService_Do_Property(t *testing.T) {
+	for name, vocabulary := range vocabularies {
+		t.Run(name, func(t *testing.T) {
+			for seed := uint64(1); seed <= 25; seed++ {
+				r := rand.New(rand.NewPCG(seed, 0))
+				input := randomInput(r, vocabulary)
+				n, mmap := 1+r.IntN(40), r.IntN(2) == 0
+				t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+					checkAgainstReference(t, input, n, mmap)
+				})
+			}
+		})
+	}
+}
+
+// TestService_DoPartitioned_Property runs partitioned jobs of random inputs
+// with random N, workers reducing the partitions in parallel, and hash or
+// range partitioners of random sizes.
+func TestService_DoPartitioned_Property(t *testing.T) {
+	for name, vocabulary := range vocabularies {
+		t.Run(name, func(t *testing.T) {
+			for seed := uint64(1); seed <= 25; seed++ {
+				r := rand.New(rand.NewPCG(seed, 1))
+				input := randomInput(r, vocabulary)
+				n, workers := 1+r.IntN(40), 1+r.IntN(4)
+				partitioner := randomPartitioner(t, r, vocabulary)
+				t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+					checkPartitioned(t, input, n, workers, partitioner)
+				})
+			}
+		})
+	}
+}
+
+// randomPartitioner is a hash partitioner, or a range partitioner with bounds
+// from the vocabulary, of 1 to 5 partitions.
+func randomPartitioner(t *testing.T, r *rand.Rand, vocabulary func(r *rand.Rand) string) mapreduce.Partitioner {
+	if r.IntN(2) == 0 {
+		partitioner, err := mapreduce.NewHashPartitioner(1 + r.IntN(5))
+		require.NoError(t, err)
+		return partitioner
+	}
+
+	var bounds []string
+	for i := r.IntN(5); i > 0; i-- {
+		bounds = append(bounds, vocabulary(r))
+	}
+	slices.Sort(bounds)
+	partitioner, err := mapreduce.NewRangePartitioner(slices.Compact(bounds))
+	require.NoError(t, err)
+	return partitioner
+}
+
+func TestService_Do_EdgeCases(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: ""},
+		{name: "only empty lines", input: "\n\n\r\n\n"},
+		{name: "no trailing newline", input: "b\na\nb"},
+		{name: "crlf", input: "a\r\nb\r\na\r\n"},
+		{name: "duplicates only", input: strings.Repeat("x\n", 1000)},
+		{name: "unicode", input: "日本\nß\n😀\n日本\né\né\n😀\n日本\n"},
+		{name: "tabs in words", input: "a\tb\na\na\tb\nb\t\n\ta\n"},
+		{name: "long words", input: strings.Repeat("a", 60000) + "\n" + strings.Repeat("a", 59999) + "\n" + strings.Repeat("a", 60000) + "\n"},
+		{name: "one word per spill", input: "e\nd\nc\nb\na\ne\nd\nc\nb\na\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, n := range []int{1, 2, 3, 1000} {
+				checkAgainstReference(t, []byte(tt.input), n, false)
+				checkAgainstReference(t, []byte(tt.input), n, true)
+				checkPartitioned(t, []byte(tt.input), n, 2, hashPartitioner(t, 3))
+			}
+		})
+	}
+}
+
+func TestService_Do_LineTooLong(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "input.txt")
+	require.NoError(t, os.WriteFile(name, []byte("a\n"+strings.Repeat("b", bufio.MaxScanTokenSize+1)+"\n"), 0o644))
+
+	for _, mmap := range []bool{false, true} {
+		t.Run(fmt.Sprintf("mmap=%v", mmap), func(t *testing.T) {
+			var opts []fileAdapter.Option
+			if mmap {
+				opts = append(opts, fileAdapter.WithMmap())
+			}
+			svc := mapreduce.NewService(10, 1, fileAdapter.NewStorage(opts...), mapreduce.WithTempDir(dir))
+
+			// the line is longer than a buffered reader holds, the job fails
+			// instead of counting what it read before it
+			_, _, err := svc.Do(context.Background(), name)
+			assert.ErrorIs(t, err, bufio.ErrTooLong)
+		})
+	}
+}
+
+func hashPartitioner(t *testing.T, partitions int) mapreduce.Partitioner {
+	partitioner, err := mapreduce.NewHashPartitioner(partitions)
+	require.NoError(t, err)
+	return partitioner
+}
+
+// FuzzService_Do compares Do, DoTo and DoPartitioned with the reference on
+// any input, N and workers:
+//
+//	go test -fuzz FuzzService_Do ./internal/domain/mapreduce
+func FuzzService_Do(f *testing.F) {
+	f.Add([]byte("b\na\nb\nc\n\nb\nd\na\n"), uint8(2), uint8(2), false)
+	f.Add([]byte("日本\r\nß\n\n😀"), uint8(1), uint8(1), true)
+	f.Add([]byte("a\tb\na\x00\n\xff\n"), uint8(3), uint8(4), false)
+	f.Add([]byte(strings.Repeat("x\n", 50)), uint8(1), uint8(3), true)
+
+	f.Fuzz(func(t *testing.T, input []byte, n, workers uint8, mmap bool) {
+		scanner := bufio.NewScanner(bytes.NewReader(input))
+		for scanner.Scan() {
+		}
+		if scanner.Err() != nil {
+			t.Skip("a line too long for the buffered reader")
+		}
+		checkAgainstReference(t, input, 1+int(n%64), mmap)
+		checkPartitioned(t, input, 1+int(n%64), 1+int(workers%8), hashPartitioner(t, 1+int(n%5)))
+	})
+}
@@ -0,0 +1,233 @@
+package mapreduce
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ResultWriter writes rows of the final result table. Intermediate files are
+// always plain "word\tcount" lines, ResultWriter is only used for the output
+// handed to the user.
+type ResultWriter interface {
+	Write(word string, count int64) error
+	// Close finishes the format (closing brackets, buffered rows) and closes the output file.
+	Close() error
+}
+
+// OutputFormat is the encoding of the final result table.
+type OutputFormat int
+
+const (
+	// FormatTSV is "word\tcount" lines, with \\, \t, \n and \r escaped in words.
+	FormatTSV OutputFormat = iota
+	// FormatCSV is RFC 4180 CSV.
+	FormatCSV
+	// FormatNDJSON is one {"word":...,"count":...} object per line.
+	FormatNDJSON
+	// FormatJSON is a single {"word":count,...} object.
+	FormatJSON
+	// FormatBinary is a sequence of uvarint(len(word)), word, uvarcount records.
+	FormatBinary
+)
+
+// binaryMagic starts a binary result when the header is requested.
+const binaryMagic = "WFB1"
+
+// ParseOutputFormat parses the CLI name of an output format.
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	switch s {
+	case "tsv":
+		return FormatTSV, nil
+	case "csv":
+		return FormatCSV, nil
+	case "ndjson":
+		return FormatNDJSON, nil
+	case "json":
+		return FormatJSON, nil
+	case "binary":
+		return FormatBinary, nil
+	default:
+		return 0, fmt.Errorf("unknown output format %q, expected tsv, csv, ndjson, json or binary", s)
+	}
+}
+
+func (f OutputFormat) String() string {
+	switch f {
+	case FormatTSV:
+		return "tsv"
+	case FormatCSV:
+		return "csv"
+	case FormatNDJSON:
+		return "ndjson"
+	case FormatJSON:
+		return "json"
+	case FormatBinary:
+		return "binary"
+	default:
+		return fmt.Sprintf("OutputFormat(%d)", int(f))
+	}
+}
+
+// Extension is the usual file extension of the format, without the dot.
+func (f OutputFormat) Extension() string {
+	if f == FormatBinary {
+		return "bin"
+	}
+	return f.String()
+}
+
+// NewResultWriter creates a writer of the given format on top of out.
+// header adds a "word","count" header row for tsv and csv and a magic
+// prefix for binary, it is ignored by json formats.
+func NewResultWriter(out OutputFile, format OutputFormat, header bool) (ResultWriter, error) {
+	var w ResultWriter
+	switch format {
+	case FormatTSV:
+		w = &tsvWriter{out: out}
+		if header {
+			if err := out.Write("word\tcount\n"); err != nil {
+				return nil, fmt.Errorf("write header failed, error=%w", err)
+			}
+		}
+	case FormatCSV:
+		cw := &csvWriter{out: out, writer: csv.NewWriter(outputFileWriter{out: out})}
+		if header {
+			if err := cw.writer.Write([]string{"word", "count"}); err != nil {
+				return nil, fmt.Errorf("write header failed, error=%w", err)
+			}
+		}
+		w = cw
+	case FormatNDJSON:
+		w = &ndjsonWriter{out: out}
+	case FormatJSON:
+		if err := out.Write("{"); err != nil {
+			return nil, fmt.Errorf("write json object start failed, error=%w", err)
+		}
+		w = &jsonWriter{out: out}
+	case FormatBinary:
+		w = &binaryWriter{out: out}
+		if header {
+			if err := out.Write(binaryMagic); err != nil {
+				return nil, fmt.Errorf("write header failed, error=%w", err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown output format %v", format)
+	}
+
+	return w, nil
+}
+
+// outputFileWriter lets io.Writer based encoders write into an OutputFile.
+type outputFileWriter struct {
+	out OutputFile
+}
+
+func (w outputFileWriter) Write(p []byte) (int, error) {
+	if err := w.out.Write(string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+type tsvWriter struct {
+	out OutputFile
+}
+
+func (w *tsvWriter) Write(word string, count int64) error {
+	return w.out.Write(tsvEscaper.Replace(word) + "\t" + strconv.FormatInt(count, 10) + "\n")
+}
+
+func (w *tsvWriter) Close() error {
+	return w.out.Close()
+}
+
+type csvWriter struct {
+	out    OutputFile
+	writer *csv.Writer
+}
+
+func (w *csvWriter) Write(word string, count int64) error {
+	return w.writer.Write([]string{word, strconv.FormatInt(count, 10)})
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	var err error
+	if flushErr := w.writer.Error(); flushErr != nil {
+		err = fmt.Errorf("csv flush failed, error=%w", flushErr)
+	}
+	return errors.Join(err, w.out.Close())
+}
+
+type ndjsonWriter struct {
+	out OutputFile
+}
+
+type ndjsonRow struct {
+	Word  string `json:"word"`
+	Count int64  `json:"count"`
+}
+
+func (w *ndjsonWriter) Write(word string, count int64) error {
+	row, err := json.Marshal(ndjsonRow{Word: word, Count: count})
+	if err != nil {
+		return fmt.Errorf("marshal row failed, error=%w", err)
+	}
+	return w.out.Write(string(row) + "\n")
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.out.Close()
+}
+
+type jsonWriter struct {
+	out      OutputFile
+	notFirst bool
+}
+
+func (w *jsonWriter) Write(word string, count int64) error {
+	key, err := json.Marshal(word)
+	if err != nil {
+		return fmt.Errorf("marshal word failed, error=%w", err)
+	}
+	sep := ""
+	if w.notFirst {
+		sep = ","
+	}
+	w.notFirst = true
+
+	return w.out.Write(sep + string(key) + ":" + strconv.FormatInt(count, 10))
+}
+
+func (w *jsonWriter) Close() error {
+	var err error
+	if writeErr := w.out.Write("}\n"); writeErr != nil {
+		err = fmt.Errorf("write json object end failed, error=%w", writeErr)
+	}
+	return errors.Join(err, w.out.Close())
+}
+
+type binaryWriter struct {
+	out OutputFile
+	buf []byte
+}
+
+func (w *binaryWriter) Write(word string, count int64) error {
+	w.buf = binary.AppendUvarint(w.buf[:0], uint64(len(word)))
+	w.buf = append(w.buf, word...)
+	w.buf = binary.AppendUvarint(w.buf, uint64(count))
+
+	return w.out.Write(string(w.buf))
+}
+
+func (w *binaryWriter) Close() error {
+	return w.out.Close()
+}
@@ -0,0 +1,48 @@
+package mapreduce_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+	mapReduceMocks "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce/mocks"
+)
+
+func TestResultWriter_Formats(t *testing.T) {
+	rows := []mapreduce.WordCount{{"a\tb", 2}, {`q"uote`, 1}, {"c,d", 1}}
+	tests := []struct {
+		format mapreduce.OutputFormat
+		header bool
+		want   string
+	}{
+		{mapreduce.FormatTSV, true, "word\tcount\na\\tb\t2\nq\"uote\t1\nc,d\t1\n"},
+		{mapreduce.FormatCSV, true, "word,count\na\tb,2\n\"q\"\"uote\",1\n\"c,d\",1\n"},
+		{mapreduce.FormatNDJSON, false, `{"word":"a\tb","count":2}` + "\n" + `{"word":"q\"uote","count":1}` + "\n" + `{"word":"c,d","count":1}` + "\n"},
+		{mapreduce.FormatJSON, true, `{"a\tb":2,"q\"uote":1,"c,d":1}` + "\n"},
+		{mapreduce.FormatBinary, false, "\x03a\tb\x02\x06q\"uote\x01\x03c,d\x01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			mockOutput := new(mapReduceMocks.OutputFile)
+			var written strings.Builder
+			mockOutput.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+				written.WriteString(args.String(0))
+			}).Return(nil)
+			mockOutput.On("Close").Return(nil)
+
+			w, err := mapreduce.NewResultWriter(mockOutput, tt.format, tt.header)
+			assert.NoError(t, err)
+			for _, row := range rows {
+				assert.NoError(t, w.Write(row.Word, row.Count))
+			}
+			assert.NoError(t, w.Close())
+
+			assert.Equal(t, tt.want, written.String())
+			mockOutput.AssertExpectations(t)
+		})
+	}
+}
@@ -5,14 +5,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 )
 
 //go:generate go run github.com/vektra/mockery/v2@v2.43.2 --all
 
-type Storage interface {
+// Source opens inputs to be counted.
+type Source interface {
 	OpenInputFile(name string) (InputFile, error)
+}
+
+// Storage keeps intermediate files and results, by default it is also the Source of inputs.
+type Storage interface {
+	Source
 	CreateOutputFile(name string) (OutputFile, error)
 }
 
@@ -20,106 +32,397 @@ type InputFile interface {
 	Close() error
 	Scan() bool
 	ReadLine() string
-	ReadMappedLine() (string, int, error)
+	ReadMappedLine() (string, int64, error)
+	// ReadRecord is ReadMappedLine without copying the word, the key is only
+	// valid until the next Scan.
+	ReadRecord() ([]byte, int64, error)
 	Err() error
 }
 
+// LineBytesReader is implemented by inputs that can hand out the current line
+// without copying it. The mapper then only allocates a string for new words.
+type LineBytesReader interface {
+	ReadLineBytes() []byte
+}
+
 type OutputFile interface {
 	Close() error
 	Write(line string) error
+	// WriteRecord writes a "key\tcount\n" line, key is not retained.
+	WriteRecord(key []byte, count int64) error
 }
 
+// Inputs iterates over several inputs that are counted as one. The InputFile
+// passed to fn is only valid during the call, Inputs closes it.
+type Inputs func(fn func(name string, input InputFile) error) error
+
 type Service struct {
 	n       int
 	workers int
 	storage Storage
+	source  Source
+	// results of DoPartitioned go here, nil is the storage
+	resultStorage Storage
+
+	memoryFastPath bool
+	tempDir        string
+	saturateCounts bool
+	progress       *progressTracker
+	metrics        *Metrics
+	logger         *slog.Logger
+	tracer         Tracer
+	manifest       string
+
+	spaceRetryInterval time.Duration
+	spaceRetryTimeout  time.Duration
+	spaceMu            sync.Mutex
+	spaceReserved      int64 // by spills and merges running
+}
+
+// Option configures optional behaviour of the Service.
+type Option func(*Service)
+
+// WithMemoryFastPath makes DoTo and TopK skip the storage entirely when the
+// whole input has less than N unique words: the counts are sorted and
+// emitted straight from memory instead of being spilled and merged.
+func WithMemoryFastPath() Option {
+	return func(s *Service) {
+		s.memoryFastPath = true
+	}
+}
+
+// WithSource reads inputs from source instead of the storage, intermediate
+// files and results still go to the storage.
+func WithSource(source Source) Option {
+	return func(s *Service) {
+		s.source = source
+	}
 }
 
-func NewService(n, workers int, storage Storage) *Service {
-	return &Service{
+// WithResultStorage writes the part files and the index of DoPartitioned to
+// storage instead of the storage of the intermediate files, e.g. one that
+// isn't capped like them.
+func WithResultStorage(storage Storage) Option {
+	return func(s *Service) {
+		s.resultStorage = storage
+	}
+}
+
+// WithTempDir puts intermediate files under dir, a directory or a URL prefix
+// the storage understands, e.g. s3://bucket/tmp. Default is the current directory.
+func WithTempDir(dir string) Option {
+	return func(s *Service) {
+		s.tempDir = strings.TrimSuffix(dir, "/")
+	}
+}
+
+// WithSaturatingCounts makes a sum of counts that doesn't fit in int64 stick
+// at the int64 limit instead of failing the job with ErrCountOverflow.
+func WithSaturatingCounts() Option {
+	return func(s *Service) {
+		s.saturateCounts = true
+	}
+}
+
+func NewService(n, workers int, storage Storage, opts ...Option) *Service {
+	s := &Service{
 		n:       n,
 		workers: workers,
 		storage: storage,
+		source:  storage,
+		logger:  slog.New(discardHandler{}),
+		tracer:  noopTracer{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// results is the storage of the results of DoPartitioned.
+func (s *Service) results() Storage {
+	if s.resultStorage == nil {
+		return s.storage
 	}
+	return s.resultStorage
 }
 
-func (s *Service) Do(ctx context.Context, inputFileName string) (string, error) {
-	tempFiles, err := s.MapAndShuffle(ctx, inputFileName)
+// startJob logs the start of a job and starts its span. It returns the ctx of
+// the job and the func that cleans up its files, logs and ends it, call it
+// deferred with the address of the job's error.
+func (s *Service) startJob(ctx context.Context, job string, attrs ...slog.Attr) (context.Context, func(err *error)) {
+	args := make([]any, 0, len(attrs)+1)
+	args = append(args, slog.String("job", job))
+	for _, attr := range attrs {
+		args = append(args, attr)
+	}
+	logger := s.logger.With(args...)
+	logger.InfoContext(ctx, "job started")
+	ctx, span := s.tracer.Start(ctx, job, attrs...)
+	ctx, files := withJobFiles(ctx)
+	start := time.Now()
+
+	return ctx, func(err *error) {
+		*err = errors.Join(*err, s.finishFiles(ctx, files, *err))
+		span.End(*err)
+		if *err != nil {
+			logger.ErrorContext(ctx, "job failed", "duration", time.Since(start), "error", *err)
+			return
+		}
+		logger.InfoContext(ctx, "job finished", "duration", time.Since(start))
+	}
+}
+
+// Do counts words of the input into a result file and returns its name with
+// the Stats of the job.
+func (s *Service) Do(ctx context.Context, inputFileName string) (_ string, _ Stats, err error) {
+	ctx, end := s.startJob(ctx, "do", slog.String("input", inputFileName))
+	defer end(&err)
+	ctx, stats := withJobStats(ctx)
+	filesFrom(ctx).resumable(inputFileName)
+
+	tempFiles, _, err := s.mapOrResume(ctx, s.openInput(inputFileName), false)
 	if err != nil {
-		return "", fmt.Errorf("map and shuffle stage failed, error=%w", err)
+		return "", Stats{}, fmt.Errorf("map and shuffle stage failed, error=%w", err)
 	}
 
 	outputFileName, err := s.reduce(ctx, tempFiles)
 	if err != nil {
-		return "", fmt.Errorf("reduce stage failed, error=%w", err)
+		return "", Stats{}, fmt.Errorf("reduce stage failed, error=%w", err)
 	}
+	stats.resultFile(outputFileName)
 
-	return outputFileName, nil
+	return outputFileName, stats.finish(), nil
 }
 
-func (s *Service) MapAndShuffle(ctx context.Context, inputFileName string) (tempFiles []string, err error) {
-	inputFile, err := s.storage.OpenInputFile(inputFileName)
+// DoTo counts words of the input and streams the result table into w in the
+// given order. w is not closed.
+func (s *Service) DoTo(ctx context.Context, inputFileName string, order SortOrder, w ResultWriter) (_ Stats, err error) {
+	ctx, end := s.startJob(ctx, "do", slog.String("input", inputFileName), slog.String("order", order.String()))
+	defer end(&err)
+	filesFrom(ctx).resumable(inputFileName)
+
+	return s.doInputsTo(ctx, s.openInput(inputFileName), order, w)
+}
+
+// DoInputsTo is DoTo over several inputs, e.g. members of an archive, whose
+// words are counted together.
+func (s *Service) DoInputsTo(ctx context.Context, inputs Inputs, order SortOrder, w ResultWriter) (_ Stats, err error) {
+	ctx, end := s.startJob(ctx, "do", slog.String("order", order.String()))
+	defer end(&err)
+
+	return s.doInputsTo(ctx, inputs, order, w)
+}
+
+func (s *Service) doInputsTo(ctx context.Context, inputs Inputs, order SortOrder, w ResultWriter) (Stats, error) {
+	ctx, stats := withJobStats(ctx)
+	emit := func(word string, count int64) error {
+		stats.resultRow(count)
+		return w.Write(word, count)
+	}
+
+	err := s.emitInputs(ctx, inputs, order, emit)
 	if err != nil {
-		return nil, fmt.Errorf("open input file failed, error=%w", err)
+		return Stats{}, err
 	}
-	defer func() {
-		if err := inputFile.Close(); err != nil {
-			errors.Join(err, fmt.Errorf("failed to close input. Err=%w", err))
+
+	return stats.finish(), nil
+}
+
+// emitInputs is doInputsTo that emits the rows instead of writing them.
+func (s *Service) emitInputs(ctx context.Context, inputs Inputs, order SortOrder, emit func(word string, count int64) error) error {
+	tempFiles, kept, err := s.mapOrResume(ctx, inputs, s.memoryFastPath)
+	if err != nil {
+		return fmt.Errorf("map and shuffle stage failed, error=%w", err)
+	}
+	if kept != nil {
+		return emitSorted(kept, order, emit)
+	}
+
+	if order == SortByWord {
+		err = s.reduceTo(ctx, tempFiles, emit)
+		if err != nil {
+			return fmt.Errorf("reduce stage failed, error=%w", err)
 		}
-	}()
+		return nil
+	}
 
-	wordCount := make(map[string]int)
-	fileIndex := 0
+	resultFileName, err := s.reduce(ctx, tempFiles)
+	if err != nil {
+		return fmt.Errorf("reduce stage failed, error=%w", err)
+	}
+	err = s.sortTo(ctx, resultFileName, order, emit)
+	if err != nil {
+		return fmt.Errorf("sort stage failed, error=%w", err)
+	}
 
-	for inputFile.Scan() {
-		select {
-		case <-ctx.Done():
-			return nil, fmt.Errorf("context cancelled, err if any=%w", ctx.Err())
-		default: // just continue
+	return nil
+}
+
+func (s *Service) MapAndShuffle(ctx context.Context, inputFileName string) (tempFiles []string, err error) {
+	tempFiles, _, err = s.mapAndShuffle(ctx, s.openInput(inputFileName), false)
+	return tempFiles, err
+}
+
+// mapAndShuffle is MapAndShuffle that, with keepInMemory, returns the counts
+// instead of spilling them if the whole input fits in N unique words.
+func (s *Service) mapAndShuffle(ctx context.Context, inputs Inputs, keepInMemory bool) (tempFiles []string, kept map[string]int64, err error) {
+	kept, err = s.mapInputs(ctx, inputs, keepInMemory, func(ctx context.Context, wordCount map[string]int64, fileIndex int) error {
+		tempFile, err := s.shuffleAndSendToWorker(ctx, wordCount, fileIndex)
+		if err != nil {
+			return fmt.Errorf("shuffleAndSendToWorker failed, error=%w", err)
 		}
+		tempFiles = append(tempFiles, tempFile)
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tempFiles, kept, nil
+}
+
+// mapInput counts words of the input and calls spill, with the ctx of the map
+// phase, every time N unique words are collected, and once more for the rest. With keepInMemory and
+// nothing spilled so far, the rest is returned instead of being spilled.
+func (s *Service) mapInput(ctx context.Context, inputFileName string, keepInMemory bool, spill func(ctx context.Context, wordCount map[string]int64, fileIndex int) error) (kept map[string]int64, err error) {
+	return s.mapInputs(ctx, s.openInput(inputFileName), keepInMemory, spill)
+}
 
-		word := inputFile.ReadLine()
-		if word == "" {
-			continue
+// openInput is Inputs of the single input file from the source.
+func (s *Service) openInput(inputFileName string) Inputs {
+	return func(fn func(name string, input InputFile) error) (err error) {
+		inputFile, err := s.source.OpenInputFile(inputFileName)
+		if err != nil {
+			return fmt.Errorf("open input file failed, error=%w", err)
+		}
+		if sizer, ok := s.source.(InputSizer); ok && s.progress != nil {
+			if size, err := sizer.InputSize(inputFileName); err == nil {
+				s.progress.addInputSize(size)
+			}
 		}
-		wordCount[word]++
+		defer func() {
+			if closeErr := inputFile.Close(); closeErr != nil {
+				err = errors.Join(err, fmt.Errorf("close input file failed, err=%w", closeErr))
+			}
+		}()
 
-		if len(wordCount) >= s.n {
-			tempFile, err := s.shuffleAndSendToWorker(ctx, wordCount, fileIndex)
-			if err != nil {
-				return nil, fmt.Errorf("shuffleAndSendToWorker failed, error=%w", err)
+		return fn(inputFileName, inputFile)
+	}
+}
+
+// mapInputs is mapInput over several inputs counted together.
+func (s *Service) mapInputs(ctx context.Context, inputs Inputs, keepInMemory bool, spill func(ctx context.Context, wordCount map[string]int64, fileIndex int) error) (kept map[string]int64, err error) {
+	wordCount := make(map[string]int64)
+	// interned keys of wordCount, for inputs that hand out line bytes
+	interned := make(map[string]string)
+	fileIndex := 0
+	s.progress.begin()
+	start := time.Now()
+	ctx, span := s.tracer.Start(ctx, "map")
+	// totals for the span and the stats
+	var totalLines, totalWords, totalBytes int64
+	peakKeys := 0
+	defer func() {
+		s.metrics.mapDone(start, err)
+		statsFrom(ctx).mapDone(totalWords, totalBytes, peakKeys)
+		span.SetAttributes(slog.Int64("lines", totalLines), slog.Int64("bytes", totalBytes), slog.Int("spills", fileIndex))
+		span.End(err)
+	}()
+
+	err = inputs(func(_ string, inputFile InputFile) error {
+		lines, zeroCopy := inputFile.(LineBytesReader)
+		// progress and metrics not reported yet
+		var readLines, readWords, readBytes int64
+		defer func() {
+			s.progress.read(readLines, readBytes)
+			s.metrics.read(readLines, readWords, int64(len(wordCount)))
+			totalLines, totalWords, totalBytes = totalLines+readLines, totalWords+readWords, totalBytes+readBytes
+		}()
+
+		for inputFile.Scan() {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("context cancelled, err if any=%w", ctx.Err())
+			default: // just continue
+			}
+			if readLines == progressBatch {
+				s.progress.read(readLines, readBytes)
+				s.metrics.read(readLines, readWords, int64(len(wordCount)))
+				totalLines, totalWords, totalBytes = totalLines+readLines, totalWords+readWords, totalBytes+readBytes
+				readLines, readWords, readBytes = 0, 0, 0
+			}
+			readLines++
+
+			var word string
+			if zeroCopy {
+				line := lines.ReadLineBytes()
+				readBytes += int64(len(line)) + 1
+				if len(line) == 0 {
+					continue
+				}
+				// a lookup by string(line) doesn't allocate, wordCount[string(line)]++ would
+				var ok bool
+				word, ok = interned[string(line)]
+				if !ok {
+					word = string(line)
+					interned[word] = word
+				}
+			} else {
+				word = inputFile.ReadLine()
+				readBytes += int64(len(word)) + 1
+				if word == "" {
+					continue
+				}
 			}
-			tempFiles = append(tempFiles, tempFile)
-			clear(wordCount)
-			wordCount = make(map[string]int)
-			fileIndex++
+			wordCount[word]++
+			readWords++
+
+			if len(wordCount) >= s.n {
+				peakKeys = max(peakKeys, len(wordCount))
+				err := spill(ctx, wordCount, fileIndex)
+				if err != nil {
+					return err
+				}
+				s.progress.spilled()
+				clear(wordCount)
+				wordCount = make(map[string]int64)
+				clear(interned)
+				fileIndex++
+			}
+		}
+		if err := inputFile.Err(); err != nil {
+			return fmt.Errorf("read input file failed, error=%w", err)
 		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	peakKeys = max(peakKeys, len(wordCount))
+	if keepInMemory && fileIndex == 0 {
+		return wordCount, nil
 	}
 
 	if len(wordCount) > 0 {
-		tempFile, err := s.shuffleAndSendToWorker(ctx, wordCount, fileIndex)
+		err := spill(ctx, wordCount, fileIndex)
 		if err != nil {
-			return nil, fmt.Errorf("shuffleAndSendToWorker failed, error=%w", err)
+			return nil, err
 		}
-		tempFiles = append(tempFiles, tempFile)
+		s.progress.spilled()
 		clear(wordCount)
+		fileIndex++
 	}
 
-	return tempFiles, nil
+	return nil, nil
 }
 
-func (s *Service) shuffleAndSendToWorker(ctx context.Context, wordCount map[string]int, fileIndex int) (tempFileName string, err error) {
-	tempFileName = fmt.Sprintf("temp_%d.tsv", fileIndex)
-	writer, err := s.storage.CreateOutputFile(tempFileName)
-	if err != nil {
-		return "", fmt.Errorf("create temp file failed, error=%w", err)
-	}
-	defer func() {
-		closeErr := writer.Close()
-		if closeErr != nil {
-			err = errors.Join(fmt.Errorf("close temp file failed, err=%w", err))
-		}
-	}()
+func (s *Service) shuffleAndSendToWorker(ctx context.Context, wordCount map[string]int64, fileIndex int) (tempFileName string, err error) {
+	tempFileName = s.tempName(fmt.Sprintf("temp_%d.tsv", fileIndex))
 
 	// we don't duplicate words here, since string is just a pointer to char/rune array
 	words := make([]string, 0, len(wordCount))
@@ -128,37 +431,170 @@ func (s *Service) shuffleAndSendToWorker(ctx context.Context, wordCount map[stri
 	}
 	sortInPlace(&words)
 
+	err = s.writeTempFile(ctx, tempFileName, words, wordCount)
+	if err != nil {
+		return "", err
+	}
+
+	return tempFileName, nil
+}
+
+// tempName is the storage name of an intermediate file.
+func (s *Service) tempName(name string) string {
+	if s.tempDir == "" {
+		return name
+	}
+	return s.tempDir + "/" + name
+}
+
+// emitSorted emits counts kept in memory in the given order.
+func emitSorted(wordCount map[string]int64, order SortOrder, emit func(word string, count int64) error) error {
+	entries := make([]WordEntry, 0, len(wordCount))
+	for word, count := range wordCount {
+		entries = append(entries, WordEntry{word: word, count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return order.less(entries[i], entries[j])
+	})
+
+	for _, e := range entries {
+		if err := emit(e.word, e.count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeTempFile flushes counts of the given sorted words to a temp file.
+func (s *Service) writeTempFile(ctx context.Context, tempFileName string, words []string, wordCount map[string]int64) (err error) {
+	ctx, span := s.tracer.Start(ctx, "spill", slog.String("file", tempFileName), slog.Int("keys", len(words)))
+	var size int64
+	defer func() {
+		span.SetAttributes(slog.Int64("bytes", size))
+		span.End(err)
+	}()
+
+	var need int64
+	for _, word := range words {
+		need += recordSize(word, wordCount[word])
+	}
+	release, err := s.reserveSpace(ctx, tempFileName, need)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	writer, err := s.createIntermediate(ctx, tempFileName)
+	if err != nil {
+		return fmt.Errorf("create temp file failed, error=%w", err)
+	}
+	defer func() {
+		closeErr := writer.Close()
+		if closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("close temp file failed, err=%w", closeErr))
+		}
+	}()
+
 	// flush to file
+	var key []byte // reused for every record
+	var singletons int64
 	for _, word := range words {
 		select {
 		case <-ctx.Done():
-			return "", fmt.Errorf("context cancelled, error if any=%w", ctx.Err())
+			return fmt.Errorf("context cancelled, error if any=%w", ctx.Err())
 		default:
 		}
-		line := fmt.Sprintf("%s\t%d\n", word, wordCount[word])
-		err := writer.Write(line)
+		key = append(key[:0], word...)
+		count := wordCount[word]
+		size += recordSize(word, count)
+		if count == 1 {
+			singletons++
+		}
+		err := writer.WriteRecord(key, count)
 		if err != nil {
-			return "", fmt.Errorf("temp file write line failed, error=%w", err)
+			return fmt.Errorf("temp file write line failed, error=%w", err)
 		}
 	}
+	s.metrics.spilled(size)
+	statsFrom(ctx).spilled(tempFileName, fileStats{keys: int64(len(words)), singletons: singletons, bytes: size})
+	s.logger.DebugContext(ctx, "spill written", "file", tempFileName, "keys", len(words), "bytes", size)
 
-	return tempFileName, nil
+	return nil
 }
 
+// openReadFiles opens all temp files or none, the files opened before one
+// that fails are closed.
 func (s *Service) openReadFiles(tempFiles []string) ([]InputFile, error) {
-	res := make([]InputFile, len(tempFiles))
-	for i, f := range tempFiles {
+	res := make([]InputFile, 0, len(tempFiles))
+	for _, f := range tempFiles {
 		inF, err := s.storage.OpenInputFile(f)
 		if err != nil {
-			return nil, fmt.Errorf("failed to open files in storage, err=%w", err)
+			err = fmt.Errorf("failed to open files in storage, err=%w", err)
+			for _, opened := range res {
+				if closeErr := opened.Close(); closeErr != nil {
+					err = errors.Join(err, fmt.Errorf("failed to close file, err=%w", closeErr))
+				}
+			}
+			return nil, err
 		}
-		res[i] = inF
+		res = append(res, inF)
 	}
 
 	return res, nil
 }
 
-func (s *Service) mergeSortedFiles(tempFiles []string, outputFile string) (err error) {
+func (s *Service) mergeSortedFiles(ctx context.Context, tempFiles []string, outputFile string, order SortOrder) (err error) {
+	release, err := s.reserveSpace(ctx, outputFile, s.mergeSize(tempFiles))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	writer, err := s.createIntermediate(ctx, outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create output file in storage, err=%w", err)
+	}
+	defer func() {
+		closeErr := writer.Close()
+		if closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close output file, err=%w", closeErr))
+		}
+	}()
+
+	var key []byte // reused for every record
+	var size int64
+	defer func() {
+		statsFrom(ctx).wrote(outputFile, size)
+	}()
+	return s.mergeSorted(ctx, tempFiles, order, outputFile, func(word string, count int64) error {
+		size += recordSize(word, count)
+		key = append(key[:0], word...)
+		err := writer.WriteRecord(key, count)
+		if err != nil {
+			return fmt.Errorf("temp file write line failed, error=%w", err)
+		}
+
+		return nil
+	})
+}
+
+// mergeSorted does a K-way merge of files sorted in the given order and calls
+// emit once per word with the total count, in the same order. output names
+// where emit puts the rows, for the log and the span.
+func (s *Service) mergeSorted(ctx context.Context, tempFiles []string, order SortOrder, output string, emit func(word string, count int64) error) (err error) {
+	start := time.Now()
+	ctx, span := s.tracer.Start(ctx, "merge", slog.Any("inputs", tempFiles), slog.String("output", output))
+	var records, singletons int64
+	defer func() {
+		statsFrom(ctx).merged(tempFiles, output, records, singletons)
+		span.SetAttributes(slog.Int64("records", records))
+		span.End(err)
+		if err == nil {
+			s.logger.DebugContext(ctx, "merge finished", "inputs", tempFiles, "output", output, "records", records, "duration", time.Since(start))
+		}
+	}()
+
 	files, err := s.openReadFiles(tempFiles)
 	if err != nil {
 		return fmt.Errorf("failed to open files in storage, err=%w", err)
@@ -172,44 +608,54 @@ func (s *Service) mergeSortedFiles(tempFiles []string, outputFile string) (err e
 		}
 	}()
 
-	writer, err := s.storage.CreateOutputFile(outputFile)
-	if err != nil {
-		return fmt.Errorf("failed to create output file in storage, err=%w", err)
-	}
-	defer func() {
-		closeErr := writer.Close()
-		if closeErr != nil {
-			err = errors.Join(err, fmt.Errorf("failed to close output file, err=%w", closeErr))
+	s.metrics.mergeStarted(len(files))
+	return s.mergeInputs(files, order, func(word string, count int64) error {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("context cancelled, err if any=%w", ctx.Err())
+		default: // just continue
 		}
-	}()
+		records++
+		if count == 1 {
+			singletons++
+		}
+		return emit(word, count)
+	})
+}
 
+// mergeInputs is mergeSorted over already opened files, it doesn't close them.
+func (s *Service) mergeInputs(files []InputFile, order SortOrder, emit func(word string, count int64) error) error {
 	// Create min-heap of words
-	minHeap := newWordHeap()
+	minHeap := newOrderedHeap(order.less)
 
 	for i, f := range files {
 		if f.Scan() {
-			word, count, err := f.ReadMappedLine()
+			key, count, err := f.ReadRecord()
 			if err != nil {
-				return fmt.Errorf("failed to read mapped line from file in storage, err=%w", err)
+				return fmt.Errorf("failed to read record from file in storage, err=%w", err)
 			}
-			heap.Push(minHeap, WordEntry{word: word, count: count, fileIndex: i})
+			heap.Push(minHeap, WordEntry{word: string(key), count: count, fileIndex: i})
+		} else if err := f.Err(); err != nil {
+			return fmt.Errorf("failed to read file in storage, err=%w", err)
 		}
 	}
 
 	var prevWord string
-	var totalCount int
+	var totalCount int64
 
 	for minHeap.Len() > 0 {
 		entry := heap.Pop(minHeap).(WordEntry)
 
 		if entry.word == prevWord {
-			totalCount += entry.count
+			var err error
+			totalCount, err = s.addCounts(prevWord, totalCount, entry.count)
+			if err != nil {
+				return err
+			}
 		} else {
 			if prevWord != "" {
-				line := fmt.Sprintf("%s\t%d\n", prevWord, totalCount)
-				err := writer.Write(line)
-				if err != nil {
-					return fmt.Errorf("temp file write line failed, error=%w", err)
+				if err := emit(prevWord, totalCount); err != nil {
+					return err
 				}
 			}
 			prevWord = entry.word
@@ -219,20 +665,20 @@ func (s *Service) mergeSortedFiles(tempFiles []string, outputFile string) (err e
 		// Read work from the same file
 		f := files[entry.fileIndex]
 		if f.Scan() {
-			word, count, err := f.ReadMappedLine()
+			key, count, err := f.ReadRecord()
 			if err != nil {
-				return fmt.Errorf("call ReadMappedLine failed, error=%w", err)
+				return fmt.Errorf("call ReadRecord failed, error=%w", err)
 			}
-			heap.Push(minHeap, WordEntry{word: word, count: count, fileIndex: entry.fileIndex})
+			heap.Push(minHeap, WordEntry{word: string(key), count: count, fileIndex: entry.fileIndex})
+		} else if err := f.Err(); err != nil {
+			return fmt.Errorf("failed to read file in storage, err=%w", err)
 		}
 	}
 
 	// Write last word
 	if prevWord != "" {
-		line := fmt.Sprintf("%s\t%d\n", prevWord, totalCount)
-		err := writer.Write(line)
-		if err != nil {
-			return fmt.Errorf("write failed, error=%w", err)
+		if err := emit(prevWord, totalCount); err != nil {
+			return err
 		}
 	}
 
@@ -243,29 +689,66 @@ func (s *Service) reduce(ctx context.Context, tempFiles []string) (string, error
 	if len(tempFiles) == 0 {
 		return "", fmt.Errorf("nothing to reduce")
 	}
+	tempFiles, err := s.mergeRounds(ctx, tempFiles, 1, SortByWord, "merged")
+	if err != nil {
+		return "", err
+	}
+
+	return tempFiles[0], nil
+}
+
+// reduceTo merges temp files the same way reduce does, but instead of writing
+// the last merge to a file it streams it into emit.
+func (s *Service) reduceTo(ctx context.Context, tempFiles []string, emit func(word string, count int64) error) error {
+	if len(tempFiles) == 0 {
+		return fmt.Errorf("nothing to reduce")
+	}
+	tempFiles, err := s.mergeRounds(ctx, tempFiles, 2, SortByWord, "merged")
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	statsFrom(ctx).mergePass()
+	err = s.mergeSorted(ctx, tempFiles, SortByWord, "result", emit)
+	s.metrics.reduceDone(start, err)
+	if err != nil {
+		return fmt.Errorf("final merge failed, err=%w", err)
+	}
+
+	return nil
+}
+
+// mergeRounds merges temp files pairwise in parallel until no more than
+// maxFiles are left. Merged files are named after prefix.
+func (s *Service) mergeRounds(ctx context.Context, tempFiles []string, maxFiles int, order SortOrder, prefix string) (_ []string, err error) {
+	start := time.Now()
+	defer func() {
+		s.metrics.reduceDone(start, err)
+	}()
 	outFileCounter := 0
-	for len(tempFiles) > 1 {
+	s.progress.mergeStarted(mergeRoundsNeeded(len(tempFiles), maxFiles))
+	for round := 1; len(tempFiles) > maxFiles; round++ {
 		var newFiles []string
-		eg := &errgroup.Group{}
+		roundCtx, span := s.tracer.Start(ctx, "reduce round", slog.Int("round", round), slog.Int("inputs", len(tempFiles)))
+		statsFrom(ctx).mergePass()
+		// a cancelled job stops starting merges, but waits for the started ones
+		// so that none of them creates a file after the job cleaned up
+		eg, mergeCtx := errgroup.WithContext(roundCtx)
 		mergeChan := make(chan string, len(tempFiles)/2+1)
 
-		for i := 0; i < len(tempFiles); i += 2 {
-			select {
-			case <-ctx.Done():
-				return "", fmt.Errorf("context cancelled, err if any=%w", ctx.Err())
-			default: // just continue
-			}
+		for i := 0; i < len(tempFiles) && mergeCtx.Err() == nil; i += 2 {
 			if i+1 < len(tempFiles) {
-				outputFile := fmt.Sprintf("merged_%d.tsv", outFileCounter) //i/2)
-				outFileCounter++
-				//wg.Add(1)
-				//out := outputFile
-				//f1 := tempFiles[i]
-				//f2 := tempFiles[i+1]
+				var outputFile string
+				// a resumed job merges files of an earlier one, they must not be overwritten
+				for outputFile == "" || slices.Contains(tempFiles, outputFile) {
+					outputFile = s.tempName(fmt.Sprintf("%s_%d.tsv", prefix, outFileCounter))
+					outFileCounter++
+				}
 				func(f1, f2, out string) {
 					eg.Go(func() error {
-						//defer wg.Done()
-						err := s.mergeSortedFiles([]string{f1, f2}, out)
+						s.metrics.workerStarted()
+						defer s.metrics.workerDone()
+						err := s.mergeSortedFiles(mergeCtx, []string{f1, f2}, out, order)
 						if err != nil {
 							return fmt.Errorf("merge failed, err=%w", err)
 						}
@@ -280,8 +763,12 @@ func (s *Service) reduce(ctx context.Context, tempFiles []string) (string, error
 		}
 
 		err := eg.Wait()
+		if err == nil && ctx.Err() != nil {
+			err = fmt.Errorf("context cancelled, err if any=%w", ctx.Err())
+		}
+		span.End(err)
 		if err != nil {
-			return "", err // it's ok not to close channel, it'll be GC'ed.
+			return nil, err // it's ok not to close channel, it'll be GC'ed.
 		}
 		close(mergeChan) // here we have to close channel to notify reciever below to exot range loop.
 
@@ -290,7 +777,12 @@ func (s *Service) reduce(ctx context.Context, tempFiles []string) (string, error
 		}
 
 		tempFiles = newFiles
+		if order == SortByWord {
+			// the merged files hold all counts, a failed job can resume from them
+			filesFrom(ctx).sorted(tempFiles)
+		}
+		s.progress.mergeRoundDone()
 	}
 
-	return tempFiles[0], nil
+	return tempFiles, nil
 }
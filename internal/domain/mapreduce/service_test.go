@@ -3,11 +3,20 @@ package mapreduce_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
+	memoryAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/memory"
+	sourceAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/source"
 	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
 	mapReduceMocks "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce/mocks"
 )
@@ -19,9 +28,10 @@ func TestDo(t *testing.T) {
 
 	mockStorage.On("OpenInputFile", "input.txt").Return(mockInputFile, nil)
 	mockStorage.On("CreateOutputFile", mock.Anything).Return(mockOutputFile, nil)
+	mockInputFile.On("Err").Return(nil)
 	mockInputFile.On("Close").Return(nil)
 	mockOutputFile.On("Close").Return(nil)
-	mockOutputFile.On("Write", mock.Anything).Return(nil)
+	mockOutputFile.On("WriteRecord", mock.Anything, mock.Anything).Return(nil)
 
 	mockInputFile.On("Scan").Return(true).Once()
 	mockInputFile.On("Scan").Return(false).Once()
@@ -31,7 +41,7 @@ func TestDo(t *testing.T) {
 	service := mapreduce.NewService(10, 2, mockStorage)
 	ctx := context.Background()
 
-	outputFileName, err := service.Do(ctx, "input.txt")
+	outputFileName, _, err := service.Do(ctx, "input.txt")
 	assert.NoError(t, err)
 
 	mockStorage.AssertExpectations(t)
@@ -48,7 +58,7 @@ func TestService_Do_FailOpenInput(t *testing.T) {
 
 	mockStorage.On("OpenInputFile", "input.txt").Return(nil, errors.New("file not found"))
 
-	_, err := svc.Do(ctx, "input.txt")
+	_, _, err := svc.Do(ctx, "input.txt")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "open input file failed")
 }
@@ -61,6 +71,7 @@ func TestService_MapAndShuffle_EmptyFile(t *testing.T) {
 
 	mockStorage.On("OpenInputFile", "input.txt").Return(mockInput, nil)
 	mockInput.On("Scan").Return(false) // No content in the file
+	mockInput.On("Err").Return(nil)
 	mockInput.On("Close").Return(nil)
 
 	tempFiles, err := svc.MapAndShuffle(ctx, "input.txt")
@@ -81,13 +92,197 @@ func TestService_MapAndShuffle_ValidFile(t *testing.T) {
 	mockInput.On("Scan").Return(true).Once()
 	mockInput.On("ReadLine").Return("word2").Once()
 	mockInput.On("Scan").Return(false).Once()
+	mockInput.On("Err").Return(nil)
 	mockInput.On("Close").Return(nil)
 
 	mockStorage.On("CreateOutputFile", "temp_0.tsv").Return(mockOutput, nil)
-	mockOutput.On("Write", mock.Anything).Return(nil)
+	mockOutput.On("WriteRecord", mock.Anything, mock.Anything).Return(nil)
 	mockOutput.On("Close").Return(nil)
 
 	tempFiles, err := svc.MapAndShuffle(ctx, "input.txt")
 	assert.NoError(t, err)
 	assert.Len(t, tempFiles, 1)
 }
+
+func TestService_TopK(t *testing.T) {
+	mockStorage := new(mapReduceMocks.Storage)
+	mockInput := new(mapReduceMocks.InputFile)
+	mockTemp := new(mapReduceMocks.InputFile)
+	mockOutput := new(mapReduceMocks.OutputFile)
+	svc := mapreduce.NewService(10, 1, mockStorage)
+	ctx := context.Background()
+
+	mockStorage.On("OpenInputFile", "input.txt").Return(mockInput, nil)
+	for _, word := range []string{"b", "a", "c", "b", "d", "c"} {
+		mockInput.On("Scan").Return(true).Once()
+		mockInput.On("ReadLine").Return(word).Once()
+	}
+	mockInput.On("Scan").Return(false).Once()
+	mockInput.On("Err").Return(nil)
+	mockInput.On("Close").Return(nil)
+
+	mockStorage.On("CreateOutputFile", "temp_0.tsv").Return(mockOutput, nil)
+	mockOutput.On("WriteRecord", mock.Anything, mock.Anything).Return(nil)
+	mockOutput.On("Close").Return(nil)
+
+	mockStorage.On("OpenInputFile", "temp_0.tsv").Return(mockTemp, nil)
+	for _, wc := range []mapreduce.WordCount{{"a", 1}, {"b", 2}, {"c", 2}, {"d", 1}} {
+		mockTemp.On("Scan").Return(true).Once()
+		mockTemp.On("ReadRecord").Return([]byte(wc.Word), int64(wc.Count), nil).Once()
+	}
+	mockTemp.On("Scan").Return(false).Once()
+	mockTemp.On("Err").Return(nil)
+	mockTemp.On("Close").Return(nil)
+
+	top, err := svc.TopK(ctx, "input.txt", 3, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []mapreduce.WordCount{{"b", 2}, {"c", 2}, {"a", 1}}, top)
+
+	mockStorage.AssertNotCalled(t, "CreateOutputFile", "output.tsv")
+	mockTemp.AssertExpectations(t)
+}
+
+func TestService_TopK_FullOutput(t *testing.T) {
+	storage := memoryAdapter.NewStorage()
+	storage.Put("input.txt", []byte("b\na\tb\nc\nb\na\tb\nb\n"))
+	svc := mapreduce.NewService(2, 1, storage)
+
+	out, err := storage.CreateOutputFile("all.tsv")
+	require.NoError(t, err)
+	full, err := mapreduce.NewResultWriter(out, mapreduce.FormatTSV, true)
+	require.NoError(t, err)
+	top, err := svc.TopK(context.Background(), "input.txt", 1, full)
+	require.NoError(t, err)
+	require.NoError(t, full.Close())
+
+	assert.Equal(t, []mapreduce.WordCount{{"b", 3}}, top)
+	data, _ := storage.Get("all.tsv")
+	assert.Equal(t, "word\tcount\na\\tb\t2\nb\t3\nc\t1\n", string(data))
+}
+
+func TestService_Sort_CountDesc(t *testing.T) {
+	mockStorage := new(mapReduceMocks.Storage)
+	mockResult := new(mapReduceMocks.InputFile)
+	mockOutput := new(mapReduceMocks.OutputFile)
+	svc := mapreduce.NewService(10, 1, mockStorage)
+	ctx := context.Background()
+
+	mockStorage.On("OpenInputFile", "merged_0.tsv").Return(mockResult, nil)
+	for _, wc := range []mapreduce.WordCount{{"a", 1}, {"b", 3}, {"c", 1}} {
+		mockResult.On("Scan").Return(true).Once()
+		mockResult.On("ReadRecord").Return([]byte(wc.Word), int64(wc.Count), nil).Once()
+	}
+	mockResult.On("Scan").Return(false).Once()
+	mockResult.On("Err").Return(nil)
+	mockResult.On("Close").Return(nil)
+
+	var lines []string
+	mockStorage.On("CreateOutputFile", "sorted_0.tsv").Return(mockOutput, nil)
+	mockOutput.On("WriteRecord", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		lines = append(lines, fmt.Sprintf("%s\t%d\n", args.Get(0), args.Get(1)))
+	}).Return(nil)
+	mockOutput.On("Close").Return(nil)
+
+	sorted, err := svc.Sort(ctx, "merged_0.tsv", mapreduce.SortByCountDesc)
+	assert.NoError(t, err)
+	assert.Equal(t, "sorted_0.tsv", sorted)
+	assert.Equal(t, []string{"b\t3\n", "a\t1\n", "c\t1\n"}, lines)
+}
+
+func TestService_DoTo_MemoryStorage(t *testing.T) {
+	var input strings.Builder
+	want := make(map[string]int64)
+	for i := 0; i < 200; i++ {
+		word := fmt.Sprintf("w%d", i*i%37)
+		input.WriteString(word + "\n")
+		want[word]++
+	}
+
+	tests := []struct {
+		name      string
+		n         int
+		opts      []mapreduce.Option
+		wantFiles []string
+	}{
+		{"spill and merge", 5, nil, nil},
+		{"fast path", 100, []mapreduce.Option{mapreduce.WithMemoryFastPath()}, []string{"input.txt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := memoryAdapter.NewStorage()
+			storage.Put("input.txt", []byte(input.String()))
+			svc := mapreduce.NewService(tt.n, 2, storage, tt.opts...)
+
+			w := &rowsWriter{}
+			_, err := svc.DoTo(context.Background(), "input.txt", mapreduce.SortByWord, w)
+			assert.NoError(t, err)
+
+			got := make(map[string]int64)
+			for i, row := range w.rows {
+				got[row.Word] = row.Count
+				if i > 0 {
+					assert.Less(t, w.rows[i-1].Word, row.Word)
+				}
+			}
+			assert.Equal(t, want, got)
+			if tt.wantFiles != nil {
+				assert.Equal(t, tt.wantFiles, storage.Names())
+			}
+		})
+	}
+}
+
+func TestService_DoTo_HTTPRetriesExhausted(t *testing.T) {
+	const input = "b\na\nb\nc\n\nb\n"
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// send the first lines and drop the connection, resuming never works
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Length", strconv.Itoa(len(input)))
+		w.Write([]byte(input[:4]))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer server.Close()
+
+	source := sourceAdapter.NewHTTPSource(server.Client(), 2, time.Millisecond)
+	svc := mapreduce.NewService(2, 1, memoryAdapter.NewStorage(), mapreduce.WithSource(source))
+
+	// the lines read before the failure must not be counted as the result
+	w := &rowsWriter{}
+	_, err := svc.DoTo(context.Background(), server.URL+"/input.txt", mapreduce.SortByWord, w)
+	assert.ErrorContains(t, err, "status=503")
+	assert.Empty(t, w.rows)
+}
+
+// failingReader returns data and then err.
+type failingReader struct {
+	data string
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestService_DoTo_ReaderFails(t *testing.T) {
+	source := sourceAdapter.NewReaderSource(&failingReader{data: "a\nb\na\n", err: errors.New("connection reset")})
+	svc := mapreduce.NewService(2, 1, memoryAdapter.NewStorage(), mapreduce.WithSource(source))
+
+	w := &rowsWriter{}
+	_, err := svc.DoTo(context.Background(), "-", mapreduce.SortByWord, w)
+	assert.ErrorContains(t, err, "connection reset")
+	assert.Empty(t, w.rows)
+}
@@ -0,0 +1,200 @@
+package mapreduce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+// SortOrder is the order of rows in the result table.
+type SortOrder int
+
+const (
+	// SortByWord is alphabetical order, the one produced by Do.
+	SortByWord SortOrder = iota
+	// SortByCount is ascending count, ties broken by word.
+	SortByCount
+	// SortByCountDesc is descending count, ties broken by word.
+	SortByCountDesc
+)
+
+// ParseSortOrder parses the CLI name of a sort order.
+func ParseSortOrder(s string) (SortOrder, error) {
+	switch s {
+	case "word":
+		return SortByWord, nil
+	case "count":
+		return SortByCount, nil
+	case "count-desc":
+		return SortByCountDesc, nil
+	default:
+		return 0, fmt.Errorf("unknown sort order %q, expected word, count or count-desc", s)
+	}
+}
+
+func (o SortOrder) String() string {
+	switch o {
+	case SortByWord:
+		return "word"
+	case SortByCount:
+		return "count"
+	case SortByCountDesc:
+		return "count-desc"
+	default:
+		return fmt.Sprintf("SortOrder(%d)", int(o))
+	}
+}
+
+func (o SortOrder) less(a, b WordEntry) bool {
+	switch o {
+	case SortByCount:
+		if a.count != b.count {
+			return a.count < b.count
+		}
+	case SortByCountDesc:
+		if a.count != b.count {
+			return a.count > b.count
+		}
+	}
+	return a.word < b.word
+}
+
+// Sort reorders an alphabetical result file produced by Do. It is an external
+// sort: the file is cut into runs of N rows, each run is sorted in memory and
+// spilled, then the runs are merged the same way reduce merges temp files.
+// Returns the name of the sorted file.
+func (s *Service) Sort(ctx context.Context, resultFileName string, order SortOrder) (_ string, err error) {
+	ctx, end := s.startJob(ctx, "sort", slog.String("input", resultFileName), slog.String("order", order.String()))
+	defer end(&err)
+
+	if order == SortByWord {
+		return resultFileName, nil
+	}
+
+	runs, err := s.spillSortedRuns(ctx, resultFileName, order)
+	if err != nil {
+		return "", fmt.Errorf("spill sorted runs failed, error=%w", err)
+	}
+	if len(runs) == 0 {
+		return "", fmt.Errorf("nothing to sort")
+	}
+
+	runs, err = s.mergeRounds(ctx, runs, 1, order, "sorted_merged")
+	if err != nil {
+		return "", fmt.Errorf("merge sorted runs failed, error=%w", err)
+	}
+
+	return runs[0], nil
+}
+
+// sortTo is Sort that streams the last merge into emit instead of a file.
+func (s *Service) sortTo(ctx context.Context, resultFileName string, order SortOrder, emit func(word string, count int64) error) error {
+	runs, err := s.spillSortedRuns(ctx, resultFileName, order)
+	if err != nil {
+		return fmt.Errorf("spill sorted runs failed, error=%w", err)
+	}
+	if len(runs) == 0 {
+		return fmt.Errorf("nothing to sort")
+	}
+
+	runs, err = s.mergeRounds(ctx, runs, 2, order, "sorted_merged")
+	if err != nil {
+		return fmt.Errorf("merge sorted runs failed, error=%w", err)
+	}
+	statsFrom(ctx).mergePass()
+	err = s.mergeSorted(ctx, runs, order, "result", emit)
+	if err != nil {
+		return fmt.Errorf("final merge failed, err=%w", err)
+	}
+
+	return nil
+}
+
+func (s *Service) spillSortedRuns(ctx context.Context, resultFileName string, order SortOrder) (runs []string, err error) {
+	inputFile, err := s.storage.OpenInputFile(resultFileName)
+	if err != nil {
+		return nil, fmt.Errorf("open result file failed, error=%w", err)
+	}
+	defer func() {
+		if closeErr := inputFile.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close result file, err=%w", closeErr))
+		}
+	}()
+
+	batch := make([]WordEntry, 0, s.n)
+	for inputFile.Scan() {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("context cancelled, err if any=%w", ctx.Err())
+		default: // just continue
+		}
+
+		key, count, err := inputFile.ReadRecord()
+		if err != nil {
+			return nil, fmt.Errorf("call ReadRecord failed, error=%w", err)
+		}
+		batch = append(batch, WordEntry{word: string(key), count: count})
+
+		if len(batch) >= s.n {
+			run, err := s.writeSortedRun(ctx, batch, order, len(runs))
+			if err != nil {
+				return nil, err
+			}
+			runs = append(runs, run)
+			batch = batch[:0]
+		}
+	}
+	if err := inputFile.Err(); err != nil {
+		return nil, fmt.Errorf("read result file failed, error=%w", err)
+	}
+
+	if len(batch) > 0 {
+		run, err := s.writeSortedRun(ctx, batch, order, len(runs))
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+func (s *Service) writeSortedRun(ctx context.Context, batch []WordEntry, order SortOrder, runIndex int) (runFileName string, err error) {
+	sort.Slice(batch, func(i, j int) bool {
+		return order.less(batch[i], batch[j])
+	})
+
+	runFileName = s.tempName(fmt.Sprintf("sorted_%d.tsv", runIndex))
+	var need int64
+	for _, e := range batch {
+		need += recordSize(e.word, e.count)
+	}
+	release, err := s.reserveSpace(ctx, runFileName, need)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	writer, err := s.createIntermediate(ctx, runFileName)
+	if err != nil {
+		return "", fmt.Errorf("create sorted run failed, error=%w", err)
+	}
+	defer func() {
+		if closeErr := writer.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("close sorted run failed, err=%w", closeErr))
+		}
+	}()
+
+	var key []byte // reused for every record
+	for _, e := range batch {
+		key = append(key[:0], e.word...)
+		err := writer.WriteRecord(key, int64(e.count))
+		if err != nil {
+			return "", fmt.Errorf("sorted run write line failed, error=%w", err)
+		}
+	}
+
+	return runFileName, nil
+}
@@ -0,0 +1,96 @@
+package mapreduce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInsufficientSpace is returned when a spill or merge doesn't fit in the
+// space the storage has left.
+var ErrInsufficientSpace = errors.New("insufficient space for intermediate files")
+
+// SpaceStorage is a Storage that knows how many bytes can still be written
+// next to a file. The Service checks it before every spill and merge, and
+// fails with ErrInsufficientSpace instead of leaving a half-written file.
+// FreeSpace may return an error matching errors.ErrUnsupported where it can't
+// tell, nothing is checked then.
+type SpaceStorage interface {
+	Storage
+	FreeSpace(name string) (int64, error)
+}
+
+// WithSpaceRetry makes a spill or merge that doesn't fit wait for space,
+// checking every interval, and fail only if there is still none after
+// timeout. By default it fails at once.
+func WithSpaceRetry(interval, timeout time.Duration) Option {
+	return func(s *Service) {
+		s.spaceRetryInterval = interval
+		s.spaceRetryTimeout = timeout
+	}
+}
+
+// reserveSpace waits until need bytes fit next to name and reserves them
+// until release is called, so spills and merges that run at the same time
+// don't count the same free space. The estimate is conservative, the space a
+// running merge already wrote is counted as free and as reserved.
+func (s *Service) reserveSpace(ctx context.Context, name string, need int64) (release func(), err error) {
+	storage, ok := s.storage.(SpaceStorage)
+	if !ok || need <= 0 {
+		return func() {}, nil
+	}
+
+	deadline := time.Now().Add(s.spaceRetryTimeout)
+	for {
+		free, err := storage.FreeSpace(name)
+		if errors.Is(err, errors.ErrUnsupported) {
+			return func() {}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("check free space failed, error=%w", err)
+		}
+
+		s.spaceMu.Lock()
+		available := free - s.spaceReserved
+		if available >= need {
+			s.spaceReserved += need
+			s.spaceMu.Unlock()
+			return func() {
+				s.spaceMu.Lock()
+				s.spaceReserved -= need
+				s.spaceMu.Unlock()
+			}, nil
+		}
+		s.spaceMu.Unlock()
+
+		if s.spaceRetryInterval <= 0 || time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s needs %d bytes, %d are free", ErrInsufficientSpace, name, need, max(available, 0))
+		}
+		s.logger.WarnContext(ctx, "waiting for space", "file", name, "needs", need, "free", max(available, 0))
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("context cancelled, err if any=%w", ctx.Err())
+		case <-time.After(s.spaceRetryInterval):
+		}
+	}
+}
+
+// mergeSize is an upper bound of the size of merging files: a word found in
+// several of them is written once.
+func (s *Service) mergeSize(files []string) int64 {
+	sizer, ok := s.storage.(InputSizer)
+	if !ok {
+		return 0
+	}
+	var size int64
+	for _, file := range files {
+		n, err := sizer.InputSize(file)
+		if err != nil {
+			// not known, the merge fails on opening it anyway
+			continue
+		}
+		size += n
+	}
+	return size
+}
@@ -0,0 +1,59 @@
+package mapreduce_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memoryAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/memory"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// spaceStorage has free bytes of space, after the first full checks.
+type spaceStorage struct {
+	*memoryAdapter.StorageImpl
+	mu     sync.Mutex
+	free   int64
+	full   int
+	checks int
+}
+
+func (s *spaceStorage) FreeSpace(string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checks++
+	if s.checks <= s.full {
+		return 0, nil
+	}
+	return s.free, nil
+}
+
+func TestService_Do_InsufficientSpace(t *testing.T) {
+	storage := &spaceStorage{StorageImpl: memoryAdapter.NewStorage(), free: 5}
+	storage.Put("input.txt", []byte(cleanupInput))
+	svc := mapreduce.NewService(2, 1, storage)
+
+	_, _, err := svc.Do(context.Background(), "input.txt")
+	require.ErrorIs(t, err, mapreduce.ErrInsufficientSpace)
+
+	// failed before the first spill was created
+	assert.Equal(t, []string{"input.txt"}, storage.Names())
+}
+
+func TestService_Do_WaitsForSpace(t *testing.T) {
+	storage := &spaceStorage{StorageImpl: memoryAdapter.NewStorage(), free: 1 << 20, full: 3}
+	storage.Put("input.txt", []byte(cleanupInput))
+	svc := mapreduce.NewService(2, 1, storage, mapreduce.WithSpaceRetry(time.Millisecond, time.Second))
+
+	result, _, err := svc.Do(context.Background(), "input.txt")
+	require.NoError(t, err)
+
+	data, _ := storage.Get(result)
+	assert.Equal(t, "a\t2\nb\t3\nc\t1\nd\t1\n", string(data))
+	assert.Greater(t, storage.checks, 3)
+}
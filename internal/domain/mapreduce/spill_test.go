@@ -0,0 +1,47 @@
+package mapreduce_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	fileAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/file"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+// Spills are merged as sorted runs, a spill in any other order has words the
+// merge can't find again, they come out more than once with part of the count.
+func TestDo_SpillsAreSorted(t *testing.T) {
+	// temp files are written to the working directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+
+	// 2 spills of the same 50 words, in a map order that is never sorted
+	var input, want strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&want, "w%02d\t2\n", i)
+	}
+	for spill := 0; spill < 2; spill++ {
+		for i := 49; i >= 0; i-- {
+			fmt.Fprintf(&input, "w%02d\n", i)
+		}
+	}
+	require.NoError(t, os.WriteFile("input.txt", []byte(input.String()), 0o644))
+	svc := mapreduce.NewService(50, 1, fileAdapter.NewStorage())
+
+	result, _, err := svc.Do(context.Background(), "input.txt")
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(result)
+	require.NoError(t, err)
+	assert.Equal(t, want.String(), string(data))
+}
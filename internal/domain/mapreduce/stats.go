@@ -0,0 +1,188 @@
+package mapreduce
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Stats describes a finished job.
+type Stats struct {
+	// Tokens are the words counted, UniqueKeys the distinct ones and
+	// Singletons the ones counted only once.
+	Tokens     int64 `json:"tokens"`
+	UniqueKeys int64 `json:"unique_keys"`
+	Singletons int64 `json:"singletons"`
+	// SpillRuns are the sorted temp files the map phase wrote, MergePasses
+	// the rounds of merges that brought them down to the result.
+	SpillRuns   int `json:"spill_runs"`
+	MergePasses int `json:"merge_passes"`
+	// PeakKeys is the most unique words held in memory at once.
+	PeakKeys int        `json:"peak_keys"`
+	Map      PhaseStats `json:"map"`
+	// Reduce is everything after the map phase: merges and the result.
+	Reduce PhaseStats `json:"reduce"`
+}
+
+// PhaseStats is what a phase of a job read, wrote and took.
+type PhaseStats struct {
+	// BytesRead are the input bytes while mapping and the bytes of the merged
+	// intermediate files while reducing.
+	BytesRead int64 `json:"bytes_read"`
+	// BytesWritten are the bytes of the files the phase wrote, rows streamed
+	// into a ResultWriter aren't counted.
+	BytesWritten int64         `json:"bytes_written"`
+	Wall         time.Duration `json:"wall_ns"`
+	// CPU is the CPU time of the whole process during the phase, it includes
+	// jobs running concurrently. It is 0 where the platform doesn't tell.
+	CPU time.Duration `json:"cpu_ns"`
+}
+
+type statsKey struct{}
+
+// jobStats collects Stats of the job whose ctx carries it, a nil jobStats
+// collects nothing.
+type jobStats struct {
+	mu     sync.Mutex
+	stats  Stats
+	files  map[string]fileStats
+	phase  time.Time
+	cpu    time.Duration
+	mapped bool
+}
+
+// fileStats describes an intermediate file, so the merges reading it and the
+// result know its size and keys without reading it again.
+type fileStats struct {
+	keys       int64
+	singletons int64
+	bytes      int64
+}
+
+// withJobStats starts collecting Stats of the job run with the returned ctx.
+func withJobStats(ctx context.Context) (context.Context, *jobStats) {
+	st := &jobStats{
+		files: make(map[string]fileStats),
+		phase: time.Now(),
+		cpu:   processCPUTime(),
+	}
+	return context.WithValue(ctx, statsKey{}, st), st
+}
+
+func statsFrom(ctx context.Context) *jobStats {
+	st, _ := ctx.Value(statsKey{}).(*jobStats)
+	return st
+}
+
+// mapDone ends the map phase.
+func (st *jobStats) mapDone(tokens, bytesRead int64, peakKeys int) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.stats.Tokens += tokens
+	st.stats.Map.BytesRead += bytesRead
+	st.stats.PeakKeys = max(st.stats.PeakKeys, peakKeys)
+	st.endPhase(&st.stats.Map)
+	st.mapped = true
+}
+
+func (st *jobStats) spilled(file string, f fileStats) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.stats.SpillRuns++
+	st.stats.Map.BytesWritten += f.bytes
+	st.files[file] = f
+}
+
+// merged records a merge of inputs, output is the file it wrote to, if any.
+func (st *jobStats) merged(inputs []string, output string, keys, singletons int64) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, input := range inputs {
+		st.stats.Reduce.BytesRead += st.files[input].bytes
+	}
+	f := st.files[output]
+	f.keys, f.singletons = keys, singletons
+	st.files[output] = f
+}
+
+// wrote adds bytes written to an intermediate file while reducing.
+func (st *jobStats) wrote(output string, bytes int64) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.stats.Reduce.BytesWritten += bytes
+	f := st.files[output]
+	f.bytes += bytes
+	st.files[output] = f
+}
+
+func (st *jobStats) mergePass() {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.stats.MergePasses++
+}
+
+// resultFile takes the unique keys and singletons of the result from the
+// intermediate file that became the result.
+func (st *jobStats) resultFile(name string) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	f := st.files[name]
+	st.stats.UniqueKeys, st.stats.Singletons = f.keys, f.singletons
+}
+
+// resultRow counts a row of a result that is streamed to the caller.
+func (st *jobStats) resultRow(count int64) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.stats.UniqueKeys++
+	if count == 1 {
+		st.stats.Singletons++
+	}
+}
+
+// finish ends the reduce phase and returns the Stats of the job.
+func (st *jobStats) finish() Stats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.mapped {
+		st.endPhase(&st.stats.Reduce)
+	}
+	return st.stats
+}
+
+// endPhase adds the time since the previous phase ended to p.
+func (st *jobStats) endPhase(p *PhaseStats) {
+	now, cpu := time.Now(), processCPUTime()
+	p.Wall += now.Sub(st.phase)
+	p.CPU += cpu - st.cpu
+	st.phase, st.cpu = now, cpu
+}
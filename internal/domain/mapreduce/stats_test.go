@@ -0,0 +1,77 @@
+package mapreduce_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	memoryAdapter "github.com/klimenkoOleg/large-file-processing-go/internal/adapter/memory"
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+)
+
+func TestService_Do_Stats(t *testing.T) {
+	const input = "b\na\nb\nc\n\nb\nd\na\n"
+	storage := memoryAdapter.NewStorage()
+	storage.Put("input.txt", []byte(input))
+	svc := mapreduce.NewService(2, 1, storage)
+
+	_, stats, err := svc.Do(context.Background(), "input.txt")
+	require.NoError(t, err)
+
+	// a 2, b 3, c 1, d 1
+	assert.Equal(t, int64(7), stats.Tokens)
+	assert.Equal(t, int64(4), stats.UniqueKeys)
+	assert.Equal(t, int64(2), stats.Singletons)
+	// a 1, b 2 | b 1, c 1 | b 1, d 1 | a 1, then 4 -> 2 -> 1 files
+	assert.Equal(t, 4, stats.SpillRuns)
+	assert.Equal(t, 2, stats.MergePasses)
+	assert.Equal(t, 2, stats.PeakKeys)
+	assert.Equal(t, int64(len(input)), stats.Map.BytesRead)
+	assert.Equal(t, int64(28), stats.Map.BytesWritten)
+	// a 1, b 3, c 1 | a 1, b 1, d 1, then a 2, b 3, c 1, d 1
+	assert.Equal(t, int64(28+24), stats.Reduce.BytesRead)
+	assert.Equal(t, int64(24+16), stats.Reduce.BytesWritten)
+	assert.Positive(t, stats.Map.Wall)
+	assert.Positive(t, stats.Reduce.Wall)
+}
+
+func TestService_DoTo_Stats(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            []mapreduce.Option
+		order           mapreduce.SortOrder
+		wantSpills      int
+		wantMergePasses int
+	}{
+		{"streamed merge", nil, mapreduce.SortByWord, 4, 2},
+		{"sorted by count", nil, mapreduce.SortByCountDesc, 4, 3},
+		{"kept in memory", []mapreduce.Option{mapreduce.WithMemoryFastPath()}, mapreduce.SortByWord, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := memoryAdapter.NewStorage()
+			storage.Put("input.txt", []byte("b\na\nb\nc\n\nb\nd\na\n"))
+			n := 2
+			if tt.wantSpills == 0 {
+				n = 10
+			}
+			svc := mapreduce.NewService(n, 1, storage, tt.opts...)
+			out, err := storage.CreateOutputFile("output.tsv")
+			require.NoError(t, err)
+			w, err := mapreduce.NewResultWriter(out, mapreduce.FormatTSV, false)
+			require.NoError(t, err)
+
+			stats, err := svc.DoTo(context.Background(), "input.txt", tt.order, w)
+			require.NoError(t, err)
+
+			assert.Equal(t, int64(7), stats.Tokens)
+			assert.Equal(t, int64(4), stats.UniqueKeys)
+			assert.Equal(t, int64(2), stats.Singletons)
+			assert.Equal(t, tt.wantSpills, stats.SpillRuns)
+			assert.Equal(t, tt.wantMergePasses, stats.MergePasses)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package mapreduce
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+// WordCount is a single row of the result table.
+type WordCount struct {
+	Word  string
+	Count int64
+}
+
+// topK keeps the k heaviest words seen so far in a bounded min-heap,
+// the lightest of them sits on top and is the one to be evicted.
+type topK struct {
+	k     int
+	words CountHeap
+}
+
+func newTopK(k int) *topK {
+	t := &topK{
+		k:     k,
+		words: make(CountHeap, 0, k),
+	}
+	heap.Init(&t.words)
+
+	return t
+}
+
+func (t *topK) add(word string, count int64) {
+	entry := WordEntry{word: word, count: count}
+	if t.words.Len() < t.k {
+		heap.Push(&t.words, entry)
+		return
+	}
+	if t.k == 0 || !heavier(entry, t.words[0]) {
+		return
+	}
+	t.words[0] = entry
+	heap.Fix(&t.words, 0)
+}
+
+// result returns collected words, the most frequent first.
+func (t *topK) result() []WordCount {
+	entries := make([]WordEntry, len(t.words))
+	copy(entries, t.words)
+	sort.Slice(entries, func(i, j int) bool {
+		return heavier(entries[i], entries[j])
+	})
+
+	res := make([]WordCount, len(entries))
+	for i, e := range entries {
+		res[i] = WordCount{Word: e.word, Count: e.count}
+	}
+
+	return res
+}
+
+func heavier(a, b WordEntry) bool {
+	if a.count != b.count {
+		return a.count > b.count
+	}
+	return a.word < b.word
+}
+
+// TopK returns the k most frequent words of the input, ordered by count
+// descending and by word for equal counts. The full alphabetical table is
+// also streamed into full unless it is nil, full is not closed.
+func (s *Service) TopK(ctx context.Context, inputFileName string, k int, full ResultWriter) (top []WordCount, err error) {
+	ctx, end := s.startJob(ctx, "top", slog.String("input", inputFileName), slog.Int("k", k))
+	defer end(&err)
+
+	if k < 0 {
+		return nil, fmt.Errorf("k should not be negative, got %d", k)
+	}
+
+	tempFiles, kept, err := s.mapAndShuffle(ctx, s.openInput(inputFileName), s.memoryFastPath)
+	if err != nil {
+		return nil, fmt.Errorf("map and shuffle stage failed, error=%w", err)
+	}
+
+	collector := newTopK(k)
+	emit := func(word string, count int64) error {
+		collector.add(word, count)
+		if full == nil {
+			return nil
+		}
+		err := full.Write(word, count)
+		if err != nil {
+			return fmt.Errorf("full output write failed, error=%w", err)
+		}
+
+		return nil
+	}
+
+	if kept != nil {
+		err = emitSorted(kept, SortByWord, emit)
+	} else {
+		err = s.reduceTo(ctx, tempFiles, emit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reduce stage failed, error=%w", err)
+	}
+
+	return collector.result(), nil
+}
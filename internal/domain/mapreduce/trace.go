@@ -0,0 +1,40 @@
+package mapreduce
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Tracer starts spans of the jobs of a Service, see WithTracer. The returned
+// ctx carries the new span, spans started with it are its children.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span)
+}
+
+// Span is a timed part of a job.
+type Span interface {
+	// SetAttributes adds attributes known only when the part is done, e.g. record counts.
+	SetAttributes(attrs ...slog.Attr)
+	// End finishes the span, err is what the part failed with, nil on success.
+	End(err error)
+}
+
+// WithTracer makes the Service trace its jobs: a span per job with children
+// for the map phase, every spill, every merge round and every merge.
+func WithTracer(tracer Tracer) Option {
+	return func(s *Service) {
+		s.tracer = tracer
+	}
+}
+
+// noopTracer is the default of a Service without a tracer.
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...slog.Attr) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...slog.Attr) {}
+func (noopSpan) End(error)                  {}
@@ -0,0 +1,120 @@
+package mapreduce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// resultRunFile reads a TSV result file written by the result writer as one
+// more merge run: the optional header is skipped and words are unescaped.
+type resultRunFile struct {
+	InputFile
+	started bool
+	line    string
+}
+
+func (f *resultRunFile) Scan() bool {
+	if !f.InputFile.Scan() {
+		return false
+	}
+	f.line = f.InputFile.ReadLine()
+	if !f.started {
+		f.started = true
+		if f.line == "word\tcount" {
+			return f.Scan()
+		}
+	}
+	return true
+}
+
+func (f *resultRunFile) ReadLine() string {
+	return f.line
+}
+
+func (f *resultRunFile) ReadMappedLine() (string, int64, error) {
+	return parseTSVRow(f.line)
+}
+
+func (f *resultRunFile) ReadRecord() ([]byte, int64, error) {
+	word, count, err := parseTSVRow(f.line)
+	return []byte(word), count, err
+}
+
+// negatedRunFile reads a run with negative counts, merging it subtracts it.
+type negatedRunFile struct {
+	InputFile
+}
+
+func (f negatedRunFile) ReadMappedLine() (string, int64, error) {
+	word, count, err := f.InputFile.ReadMappedLine()
+	return word, -count, err
+}
+
+func (f negatedRunFile) ReadRecord() ([]byte, int64, error) {
+	key, count, err := f.InputFile.ReadRecord()
+	return key, -count, err
+}
+
+// Update merges the counts of a new input into a previous alphabetical TSV
+// result and streams the cumulative table into w. Only the new input is mapped
+// and spilled, the previous result is merged as one more sorted run.
+// With subtract the new input is removed from the previous result instead, it
+// is an error if a count goes below zero, words whose count drops to zero are
+// left out. w is not closed.
+func (s *Service) Update(ctx context.Context, previousResultFileName, inputFileName string, subtract bool, w ResultWriter) (err error) {
+	ctx, end := s.startJob(ctx, "update", slog.String("previous", previousResultFileName), slog.String("input", inputFileName), slog.Bool("subtract", subtract))
+	defer end(&err)
+
+	tempFiles, err := s.MapAndShuffle(ctx, inputFileName)
+	if err != nil {
+		return fmt.Errorf("map and shuffle stage failed, error=%w", err)
+	}
+	if len(tempFiles) > 0 {
+		tempFiles, err = s.mergeRounds(ctx, tempFiles, 1, SortByWord, "merged")
+		if err != nil {
+			return fmt.Errorf("reduce stage failed, error=%w", err)
+		}
+	}
+
+	previous, err := s.storage.OpenInputFile(previousResultFileName)
+	if err != nil {
+		return fmt.Errorf("open previous result failed, error=%w", err)
+	}
+	files := []InputFile{&resultRunFile{InputFile: previous}}
+	defer func() {
+		for _, f := range files {
+			closeErr := f.Close()
+			if closeErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to close file, err=%w", closeErr))
+			}
+		}
+	}()
+
+	newFiles, err := s.openReadFiles(tempFiles)
+	if err != nil {
+		return fmt.Errorf("failed to open files in storage, err=%w", err)
+	}
+	for _, f := range newFiles {
+		if subtract {
+			f = negatedRunFile{InputFile: f}
+		}
+		files = append(files, f)
+	}
+
+	err = s.mergeInputs(files, SortByWord, func(word string, count int64) error {
+		if count < 0 {
+			return fmt.Errorf("word %q would have negative count %d, retracted input is not part of the previous result", word, count)
+		}
+		if count == 0 {
+			return nil
+		}
+		return w.Write(word, count)
+	})
+	if err != nil {
+		return fmt.Errorf("update merge failed, error=%w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package mapreduce_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce"
+	mapReduceMocks "github.com/klimenkoOleg/large-file-processing-go/internal/domain/mapreduce/mocks"
+)
+
+// rowsWriter is a ResultWriter collecting rows in memory.
+type rowsWriter struct {
+	rows []mapreduce.WordCount
+}
+
+func (w *rowsWriter) Write(word string, count int64) error {
+	w.rows = append(w.rows, mapreduce.WordCount{Word: word, Count: count})
+	return nil
+}
+
+func (w *rowsWriter) Close() error {
+	return nil
+}
+
+func TestService_Update(t *testing.T) {
+	tests := []struct {
+		name     string
+		subtract bool
+		want     []mapreduce.WordCount
+	}{
+		{"add", false, []mapreduce.WordCount{{"a\tb", 2}, {"c", 2}, {"d", 1}}},
+		{"subtract", true, []mapreduce.WordCount{{"a\tb", 2}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage := new(mapReduceMocks.Storage)
+			mockInput := new(mapReduceMocks.InputFile)
+			mockPrevious := new(mapReduceMocks.InputFile)
+			mockTemp := new(mapReduceMocks.InputFile)
+			mockOutput := new(mapReduceMocks.OutputFile)
+			svc := mapreduce.NewService(10, 1, mockStorage)
+
+			mockStorage.On("OpenInputFile", "input.txt").Return(mockInput, nil)
+			mockInput.On("Scan").Return(true).Once()
+			mockInput.On("ReadLine").Return("c").Once()
+			mockInput.On("Scan").Return(false).Once()
+			mockInput.On("Err").Return(nil)
+			mockInput.On("Close").Return(nil)
+			mockStorage.On("CreateOutputFile", "temp_0.tsv").Return(mockOutput, nil)
+			mockOutput.On("WriteRecord", mock.Anything, mock.Anything).Return(nil)
+			mockOutput.On("Close").Return(nil)
+
+			mockStorage.On("OpenInputFile", "output.tsv").Return(mockPrevious, nil)
+			for _, line := range []string{"word\tcount", `a\tb` + "\t2", "c\t1"} {
+				mockPrevious.On("Scan").Return(true).Once()
+				mockPrevious.On("ReadLine").Return(line).Once()
+			}
+			mockPrevious.On("Scan").Return(false).Once()
+			mockPrevious.On("Err").Return(nil)
+			mockPrevious.On("Close").Return(nil)
+
+			mockStorage.On("OpenInputFile", "temp_0.tsv").Return(mockTemp, nil)
+			mockTemp.On("Scan").Return(true).Once()
+			mockTemp.On("ReadRecord").Return([]byte("c"), int64(1), nil).Once()
+			if !tt.subtract {
+				mockTemp.On("Scan").Return(true).Once()
+				mockTemp.On("ReadRecord").Return([]byte("d"), int64(1), nil).Once()
+			}
+			mockTemp.On("Scan").Return(false).Once()
+			mockTemp.On("Err").Return(nil)
+			mockTemp.On("Close").Return(nil)
+
+			w := &rowsWriter{}
+			err := svc.Update(context.Background(), "output.tsv", "input.txt", tt.subtract, w)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, w.rows)
+			mockPrevious.AssertExpectations(t)
+		})
+	}
+}
@@ -1,37 +1,47 @@
 package mapreduce
 
-import "container/heap"
+import (
+	"container/heap"
+	"sort"
+)
 
 // Struct for word info storage
 type WordEntry struct {
 	word      string
-	count     int
+	count     int64
 	fileIndex int // Индекс файла, из которого взято слово
 }
 
-// min-heap data structure
-type WordHeap []WordEntry
+// min-heap data structure, ordered by word unless another order is given
+type WordHeap struct {
+	entries []WordEntry
+	less    func(a, b WordEntry) bool
+}
 
 func newWordHeap() *WordHeap {
-	minHeap := &WordHeap{}
+	return newOrderedHeap(SortByWord.less)
+}
+
+func newOrderedHeap(less func(a, b WordEntry) bool) *WordHeap {
+	minHeap := &WordHeap{less: less}
 	heap.Init(minHeap)
 
 	return minHeap
 }
 
-func (h WordHeap) Len() int           { return len(h) }
-func (h WordHeap) Less(i, j int) bool { return h[i].word < h[j].word }
-func (h WordHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h WordHeap) Len() int           { return len(h.entries) }
+func (h WordHeap) Less(i, j int) bool { return h.less(h.entries[i], h.entries[j]) }
+func (h WordHeap) Swap(i, j int)      { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
 
 func (h *WordHeap) Push(x interface{}) {
-	*h = append(*h, x.(WordEntry))
+	h.entries = append(h.entries, x.(WordEntry))
 }
 
 func (h *WordHeap) Pop() interface{} {
-	old := *h
+	old := h.entries
 	n := len(old)
 	x := old[n-1]
-	*h = old[0 : n-1]
+	h.entries = old[0 : n-1]
 	return x
 }
 
@@ -54,6 +64,32 @@ func (h *Words) Pop() interface{} {
 }
 
 func sortInPlace(strs *[]string) {
-	words := Words(*strs)
-	heap.Init(&words)
+	// heap.Init only establishes the heap invariant, spills must be fully sorted for the merge.
+	sort.Sort(Words(*strs))
+}
+
+// min-heap ordered by count, keeps the K most frequent words.
+// Among equal counts the alphabetically greater word is the lighter one,
+// so ties are broken deterministically by word.
+type CountHeap []WordEntry
+
+func (h CountHeap) Len() int { return len(h) }
+func (h CountHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].word > h[j].word
+}
+func (h CountHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *CountHeap) Push(x interface{}) {
+	*h = append(*h, x.(WordEntry))
+}
+
+func (h *CountHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
 }